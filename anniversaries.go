@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of anniversary, a slack user's join date or an employee's hire date. Passing a landmark
+// on the journey is celebrated like an anniversary, with the landmark's number as the years.
+const (
+	AnniversarySlack    = "slack"
+	AnniversaryWork     = "work"
+	AnniversaryLandmark = "landmark"
+)
+
+// anniversaryMilestones limits which anniversaries get celebrated, empty means every year
+var anniversaryMilestones = map[int]bool{}
+
+func parseMilestones(s string) (map[int]bool, error) {
+	milestones := map[int]bool{}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		if part == "" {
+			continue
+		}
+
+		years, err := strconv.Atoi(part)
+
+		if err != nil || years < 1 {
+			return nil, fmt.Errorf("milestones should be a comma separated list of years, got %s", s)
+		}
+
+		milestones[years] = true
+	}
+
+	return milestones, nil
+}
+
+// anniversaryYears is how many years it's been if today is an anniversary of start, going by the
+// calendar dates of each. Leap day anniversaries are celebrated on the 28th in other years.
+func anniversaryYears(start, today time.Time) (int, bool) {
+	month, day := start.Month(), start.Day()
+
+	if month == time.February && day == 29 && !isLeapYear(today.Year()) {
+		day = 28
+	}
+
+	years := today.Year() - start.Year()
+
+	if years < 1 || today.Month() != month || today.Day() != day {
+		return 0, false
+	}
+
+	return years, true
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+func celebrating(years int) bool {
+	return len(anniversaryMilestones) == 0 || anniversaryMilestones[years]
+}
+
+func pluralYears(years int) string {
+	if years == 1 {
+		return "1 year"
+	}
+	return fmt.Sprintf("%d years", years)
+}
+
+// celebrate announces an anniversary unless it was already announced. The anniversary is recorded
+// before announcing so that two runs on the same day can't both announce it.
+func celebrate(kind, subjectID string, years int, today time.Time, event *Event) error {
+	result, err := db.Exec(`
+		INSERT INTO anniversaries
+		(kind, subject_id, years, celebrated_on)
+		VALUES
+		($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, kind, subjectID, years, today.Format("2006-01-02"))
+
+	if err != nil {
+		return errors.Wrapf(err, "recording %s anniversary of %s", kind, subjectID)
+	}
+
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		return err
+	}
+
+	err = announce(event)
+
+	if err != nil {
+		// Give the next run a chance to post it
+		_, deleteErr := db.Exec("DELETE FROM anniversaries WHERE kind = $1 AND subject_id = $2 AND years = $3", kind, subjectID, years)
+
+		if deleteErr != nil {
+			return errors.Wrapf(deleteErr, "forgetting %s anniversary of %s after: %s", kind, subjectID, err)
+		}
+
+		return errors.Wrap(err, "sending anniversary message")
+	}
+
+	return nil
+}
+
+func optedOut() (map[string]bool, error) {
+	ids := []string{}
+
+	err := db.Select(&ids, "SELECT user_id FROM anniversary_opt_outs")
+
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting anniversary opt outs")
+	}
+
+	lookup := map[string]bool{}
+
+	for _, id := range ids {
+		lookup[id] = true
+	}
+
+	return lookup, nil
+}
+
+func runAnniversariesIteration() error {
+	today := time.Now()
+
+	optOuts, err := optedOut()
+
+	if err != nil {
+		return err
+	}
+
+	users, err := usersFromDatabase()
+
+	if err != nil {
+		return errors.Wrap(err, "fetching users from the database")
+	}
+
+	for i := range users {
+		user := &users[i]
+
+		// NOTE: Users sharing a made up join date would all be celebrated in one burst
+		if user.Deleted || user.Bot || user.ID == "USLACKBOT" || optOuts[user.ID] || !user.TrustedJoinDate() {
+			continue
+		}
+
+		if index, ok := landmarkReached(user.CreatedAt, today); ok {
+			event := userEvent(EventLandmark, user, landmarkEmoji(index), landmarkText(user, index))
+
+			err := celebrate(AnniversaryLandmark, user.ID, index, today, event)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		years, ok := anniversaryYears(user.CreatedAt.In(today.Location()), today)
+
+		if !ok || !celebrating(years) {
+			continue
+		}
+
+		text := fmt.Sprintf("%s has survived %s on the trail", user.Describe(), pluralYears(years))
+
+		err := celebrate(AnniversarySlack, user.ID, years, today, userEvent(EventAnniversary, user, ":birthday:", text))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	employees, err := employeesFromDatabase()
+
+	if err != nil {
+		return errors.Wrap(err, "fetching employees from the database")
+	}
+
+	for _, employee := range employees {
+		if employee.Deleted || !employee.HiredAt.Valid {
+			continue
+		}
+
+		// NOTE: Hire dates are plain dates, so they're compared as is rather than converted to local time
+		years, ok := anniversaryYears(employee.HiredAt.Time, today)
+
+		if !ok || !celebrating(years) {
+			continue
+		}
+
+		user, err := userForEmployee(employee)
+
+		if err != nil {
+			return err
+		}
+
+		if user != nil && optOuts[user.ID] {
+			continue
+		}
+
+		text := fmt.Sprintf("%s has been pulling the wagon for %s", employee.Name, pluralYears(years))
+
+		err = celebrate(AnniversaryWork, employee.ID, years, today, employeeEvent(EventAnniversary, employee, ":birthday:", text))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runAnniversariesOptOut(userRef string, optOut bool) error {
+	user, err := findUser(userRef)
+
+	if err != nil {
+		return err
+	}
+
+	if optOut {
+		_, err = db.Exec("INSERT INTO anniversary_opt_outs (user_id) VALUES ($1) ON CONFLICT DO NOTHING", user.ID)
+	} else {
+		_, err = db.Exec("DELETE FROM anniversary_opt_outs WHERE user_id = $1", user.ID)
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "updating anniversary opt out for %s", user.SomeName())
+	}
+
+	if optOut {
+		fmt.Printf("%s won't have their anniversaries celebrated\n", user.SomeName())
+	} else {
+		fmt.Printf("%s will have their anniversaries celebrated\n", user.SomeName())
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnniversaryYears(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+
+	tests := []struct {
+		start, today string
+		years        int
+		ok           bool
+	}{
+		{"2019-10-19", "2026-10-19", 7, true},
+		{"2019-10-19", "2026-10-20", 0, false},
+		{"2026-10-19", "2026-10-19", 0, false},
+		{"2020-02-29", "2025-02-28", 5, true},
+		{"2020-02-29", "2024-02-28", 0, false},
+		{"2020-02-29", "2024-02-29", 4, true},
+	}
+
+	for _, test := range tests {
+		years, ok := anniversaryYears(date(test.start), date(test.today))
+
+		if years != test.years || ok != test.ok {
+			t.Errorf("Expected %d, %v from %s to %s, got %d, %v", test.years, test.ok, test.start, test.today, years, ok)
+		}
+	}
+}
+
+func TestTrustedJoinDate(t *testing.T) {
+	tests := []struct {
+		source     string
+		confidence float64
+		trusted    bool
+	}{
+		{JoinDateObserved, 1, true},
+		{JoinDateChannelJoin, 0.9, true},
+		{JoinDateHireDate, 0.5, true},
+		{JoinDateProfileUpdate, 0.1, false},
+		{JoinDateDefault, 0, false},
+		{JoinDateInit, 0, false},
+		{JoinDateUnknown, 0, false},
+		{JoinDateInit, 1, false},
+	}
+
+	for _, test := range tests {
+		user := User{CreatedAtSource: test.source, CreatedAtConfidence: test.confidence}
+
+		if user.TrustedJoinDate() != test.trusted {
+			t.Errorf("Expected %s at %v to be trusted %v", test.source, test.confidence, test.trusted)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// Orphan is a slack user with no active employee behind them, which probably means offboarding
+// was missed, or an employee with no slack user
+type Orphan struct {
+	Kind   string
+	ID     string
+	Name   string
+	Email  string
+	Reason string
+}
+
+const (
+	OrphanKindUser     = "slack user"
+	OrphanKindEmployee = "employee"
+)
+
+// auditAccounts cross references living slack users and active employees using the same links and
+// heuristics as announcements
+func auditAccounts(users []User, employees []*Employee, links []Link, includeGuests bool) []Orphan {
+	orphans := []Orphan{}
+
+	employeeLookup := map[string]*Employee{}
+	for _, employee := range employees {
+		employeeLookup[employee.ID] = employee
+	}
+
+	linkLookup := map[string]Link{}
+	for _, link := range links {
+		linkLookup[link.UserID] = link
+	}
+
+	accounted := map[string]bool{}
+
+	for i := range users {
+		user := &users[i]
+
+		if user.Deleted || user.Bot || user.ID == "USLACKBOT" || (user.Guest && !includeGuests) {
+			continue
+		}
+
+		var employee *Employee
+		reason := "no matching employee"
+
+		if link, ok := linkLookup[user.ID]; ok {
+			employee = employeeLookup[link.EmployeeID]
+			if employee == nil {
+				reason = fmt.Sprintf("linked to unknown employee %s", link.EmployeeID)
+			}
+		} else {
+			employee, _ = matchEmployee(user, employees)
+		}
+
+		if employee != nil && employee.Deleted {
+			reason = fmt.Sprintf("linked employee %s left %s", employee.Name, employee.DeletedAt.Time.Format("2006-01-02"))
+			employee = nil
+		}
+
+		if employee == nil {
+			orphans = append(orphans, Orphan{
+				Kind:   OrphanKindUser,
+				ID:     user.ID,
+				Name:   user.SomeName(),
+				Email:  user.Email,
+				Reason: reason,
+			})
+			continue
+		}
+
+		accounted[employee.ID] = true
+	}
+
+	for _, employee := range employees {
+		if employee.Deleted || accounted[employee.ID] {
+			continue
+		}
+
+		orphans = append(orphans, Orphan{
+			Kind:   OrphanKindEmployee,
+			ID:     employee.ID,
+			Name:   employee.Name,
+			Email:  employee.Email,
+			Reason: "no matching slack user",
+		})
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		if orphans[i].Kind != orphans[j].Kind {
+			return orphans[i].Kind > orphans[j].Kind
+		}
+		return orphans[i].Name < orphans[j].Name
+	})
+
+	return orphans
+}
+
+func runAuditAccounts(format string, post bool, includeGuests bool) error {
+	// NOTE: Slack is asked directly so the audit is as of now, not as of the last users run
+	users, err := usersFromSlack()
+
+	if err != nil {
+		return errors.Wrap(err, "fetching users from slack")
+	}
+
+	employees, err := employeesFromDatabase()
+
+	if err != nil {
+		return errors.Wrap(err, "fetching employees from the database")
+	}
+
+	links, err := linksFromDatabase()
+
+	if err != nil {
+		return errors.Wrap(err, "fetching links from the database")
+	}
+
+	orphans := auditAccounts(users, employees, links, includeGuests)
+
+	switch format {
+	case "csv":
+		err = writeOrphansCSV(os.Stdout, orphans)
+	case "text":
+		err = writeOrphansText(os.Stdout, orphans)
+	default:
+		err = fmt.Errorf("unsupported format %s", format)
+	}
+
+	if err != nil || !post {
+		return err
+	}
+
+	return errors.Wrap(postOrphans(orphans), "posting audit")
+}
+
+func writeOrphansCSV(out io.Writer, orphans []Orphan) error {
+	w := csv.NewWriter(out)
+
+	err := w.Write([]string{"kind", "id", "name", "email", "reason"})
+
+	if err != nil {
+		return err
+	}
+
+	for _, orphan := range orphans {
+		err := w.Write([]string{orphan.Kind, orphan.ID, orphan.Name, orphan.Email, orphan.Reason})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+func writeOrphansText(out io.Writer, orphans []Orphan) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "KIND\tID\tNAME\tEMAIL\tREASON")
+
+	for _, orphan := range orphans {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", orphan.Kind, orphan.ID, orphan.Name, orphan.Email, orphan.Reason)
+	}
+
+	return w.Flush()
+}
+
+func postOrphans(orphans []Orphan) error {
+	users, employees := []string{}, []string{}
+
+	for _, orphan := range orphans {
+		line := fmt.Sprintf("• %s (%s)", orphan.Name, orphan.Reason)
+
+		if orphan.Kind == OrphanKindUser {
+			users = append(users, line)
+		} else {
+			employees = append(employees, line)
+		}
+	}
+
+	text := fmt.Sprintf(
+		"Account audit: %d slack users without an employee, %d employees without a slack user",
+		len(users),
+		len(employees),
+	)
+
+	if len(users) > 0 {
+		text += "\n\n*Slack users without an employee*\n" + strings.Join(users, "\n")
+	}
+
+	if len(employees) > 0 {
+		text += "\n\n*Employees without a slack user*\n" + strings.Join(employees, "\n")
+	}
+
+	return sendMessage(Message{Text: text, Emoji: ":clipboard:"})
+}
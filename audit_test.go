@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestAuditAccounts(t *testing.T) {
+	left := pq.NullTime{Time: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), Valid: true}
+
+	employees := []*Employee{
+		{ID: "E1", Name: "Jane Doe", Email: "jane@example.com"},
+		{ID: "E2", Name: "John Roe"},
+		{ID: "E3", Name: "Gone Person", Deleted: true, DeletedAt: left},
+		{ID: "E4", Name: "No Slack"},
+	}
+
+	cases := []struct {
+		name          string
+		users         []User
+		links         []Link
+		includeGuests bool
+		expected      []string
+	}{
+		{
+			name:     "bots and slackbot are skipped",
+			users:    []User{{ID: "B1", Name: "deploybot", Bot: true}, {ID: "USLACKBOT", Name: "slackbot"}},
+			expected: []string{"E1 no matching slack user", "E2 no matching slack user", "E4 no matching slack user"},
+		},
+		{
+			name:     "guests are skipped",
+			users:    []User{{ID: "G1", RealName: "Guest Person", Guest: true}},
+			expected: []string{"E1 no matching slack user", "E2 no matching slack user", "E4 no matching slack user"},
+		},
+		{
+			name:          "guests are included",
+			users:         []User{{ID: "G1", RealName: "Guest Person", Guest: true}},
+			includeGuests: true,
+			expected:      []string{"G1 no matching employee", "E1 no matching slack user", "E2 no matching slack user", "E4 no matching slack user"},
+		},
+		{
+			name: "linked and matched users are accounted for",
+			users: []User{
+				{ID: "U1", RealName: "Someone Else", Email: "JANE@example.com"},
+				{ID: "U2", RealName: "Nickname"},
+			},
+			links:    []Link{{UserID: "U2", EmployeeID: "E2"}},
+			expected: []string{"E4 no matching slack user"},
+		},
+		{
+			name:     "unlinked users",
+			users:    []User{{ID: "U3", RealName: "Nobody Known"}, {ID: "U4", RealName: "Ghost Link"}},
+			links:    []Link{{UserID: "U4", EmployeeID: "E9"}},
+			expected: []string{"U4 linked to unknown employee E9", "U3 no matching employee", "E1 no matching slack user", "E2 no matching slack user", "E4 no matching slack user"},
+		},
+		{
+			name:     "departed employees",
+			users:    []User{{ID: "U5", RealName: "Gone Person"}, {ID: "U6", RealName: "Still Here"}},
+			links:    []Link{{UserID: "U6", EmployeeID: "E3"}},
+			expected: []string{"U5 no matching employee", "U6 linked employee Gone Person left 2026-03-01", "E1 no matching slack user", "E2 no matching slack user", "E4 no matching slack user"},
+		},
+		{
+			name:     "deleted users are skipped",
+			users:    []User{{ID: "U7", RealName: "Jane Doe", Deleted: true}},
+			expected: []string{"E1 no matching slack user", "E2 no matching slack user", "E4 no matching slack user"},
+		},
+	}
+
+	for _, c := range cases {
+		orphans := auditAccounts(c.users, employees, c.links, c.includeGuests)
+		found := []string{}
+
+		for _, orphan := range orphans {
+			found = append(found, orphan.ID+" "+orphan.Reason)
+		}
+
+		if !reflect.DeepEqual(found, c.expected) {
+			t.Errorf("%s: expected orphans %q, got %q", c.name, c.expected, found)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+// Where a user's join date came from, confidence is how much to trust each one from 0 to 1. Users
+// from before join dates were tracked have the made up default date, or an unknown one.
+const (
+	JoinDateDefault       = "default"
+	JoinDateUnknown       = "unknown"
+	JoinDateObserved      = "observed"
+	JoinDateInit          = "init"
+	JoinDateChannelJoin   = "channel_join"
+	JoinDateFirstMessage  = "first_message"
+	JoinDateHireDate      = "hire_date"
+	JoinDateProfileUpdate = "profile_update"
+)
+
+// trustedJoinDateConfidence is how sure we need to be of a join date to celebrate it
+const trustedJoinDateConfidence = 0.5
+
+// TrustedJoinDate is whether CreatedAt is a real join date, and not one that lots of users share,
+// like the default date or the date the trail was initialized
+func (user *User) TrustedJoinDate() bool {
+	switch user.CreatedAtSource {
+	case JoinDateDefault, JoinDateInit, JoinDateUnknown:
+		return false
+	}
+
+	return user.CreatedAtConfidence >= trustedJoinDateConfidence
+}
+
+// JoinDateEstimate is one guess at when a user joined slack. Upper bounds are evidence the user
+// existed by then, like a message they sent, so they may have joined earlier.
+type JoinDateEstimate struct {
+	Source     string
+	At         time.Time
+	Confidence float64
+	UpperBound bool
+}
+
+// bestJoinDate picks the most trustworthy estimate, unless there's evidence the user was around
+// before it
+func bestJoinDate(estimates []JoinDateEstimate) (JoinDateEstimate, bool) {
+	if len(estimates) == 0 {
+		return JoinDateEstimate{}, false
+	}
+
+	sort.SliceStable(estimates, func(i, j int) bool {
+		return estimates[i].Confidence > estimates[j].Confidence
+	})
+
+	best := estimates[0]
+
+	for _, estimate := range estimates[1:] {
+		if estimate.UpperBound && estimate.At.Before(best.At) {
+			best = estimate
+		}
+	}
+
+	return best, true
+}
+
+// channelJoinDates finds when each user joined a channel, and when they first posted in it. Using
+// the default channel everybody is added to makes the join message a good join date for slack.
+func channelJoinDates(channelID string) (map[string][]JoinDateEstimate, error) {
+	estimates := map[string][]JoinDateEstimate{}
+	joined := map[string]time.Time{}
+	posted := map[string]time.Time{}
+
+	params := &slack.GetConversationHistoryParameters{ChannelID: channelID, Limit: 200}
+
+	for {
+		history, err := slackClient.GetConversationHistory(params)
+
+		if rateLimited, ok := err.(*slack.RateLimitedError); ok {
+			if verbose {
+				fmt.Printf("Rate limited, waiting %s...\n", rateLimited.RetryAfter)
+			}
+
+			time.Sleep(rateLimited.RetryAfter)
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting history of channel %s", channelID)
+		}
+
+		for _, message := range history.Messages {
+			at, err := parseSlackTimestamp(message.Timestamp)
+
+			if err != nil || message.User == "" {
+				continue
+			}
+
+			seen := posted
+			if message.SubType == "channel_join" {
+				seen = joined
+			}
+
+			if earliest, ok := seen[message.User]; !ok || at.Before(earliest) {
+				seen[message.User] = at
+			}
+		}
+
+		if verbose {
+			fmt.Printf("Read %d messages from %s\n", len(history.Messages), channelID)
+		}
+
+		if !history.HasMore || history.ResponseMetaData.NextCursor == "" {
+			break
+		}
+
+		params.Cursor = history.ResponseMetaData.NextCursor
+	}
+
+	for user, at := range joined {
+		estimates[user] = append(estimates[user], JoinDateEstimate{Source: JoinDateChannelJoin, At: at, Confidence: 0.9})
+	}
+
+	for user, at := range posted {
+		estimates[user] = append(estimates[user], JoinDateEstimate{Source: JoinDateFirstMessage, At: at, Confidence: 0.6, UpperBound: true})
+	}
+
+	return estimates, nil
+}
+
+func parseSlackTimestamp(ts string) (time.Time, error) {
+	seconds, err := strconv.ParseFloat(ts, 64)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(int64(seconds), 0), nil
+}
+
+// improvesJoinDate is whether an estimate is better than the join date we have. A better guess is
+// never replaced with a worse one, and an upper bound later than the join date we have says nothing
+// new, the user was around by then either way.
+func improvesJoinDate(user *User, estimate JoinDateEstimate) bool {
+	if estimate.Confidence <= user.CreatedAtConfidence {
+		return false
+	}
+
+	return !estimate.UpperBound || !estimate.At.After(user.CreatedAt)
+}
+
+func runBackfillJoinDates(channelID string, save bool) error {
+	users, err := usersFromDatabase()
+
+	if err != nil {
+		return errors.Wrap(err, "fetching users from the database")
+	}
+
+	slackers, err := slackClient.GetUsers()
+
+	if err != nil {
+		return errors.Wrap(err, "getting slack users")
+	}
+
+	estimates := map[string][]JoinDateEstimate{}
+
+	for _, slacker := range slackers {
+		if updated := slacker.Updated.Time(); slacker.Updated != 0 {
+			estimates[slacker.ID] = append(estimates[slacker.ID], JoinDateEstimate{Source: JoinDateProfileUpdate, At: updated, Confidence: 0.1, UpperBound: true})
+		}
+	}
+
+	if channelID != "" {
+		fromChannel, err := channelJoinDates(channelID)
+
+		if err != nil {
+			return err
+		}
+
+		for user, e := range fromChannel {
+			estimates[user] = append(estimates[user], e...)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "USER\tNAME\tOLD JOIN DATE\tOLD SOURCE\tNEW JOIN DATE\tNEW SOURCE\tCONFIDENCE")
+
+	updated := 0
+
+	for i := range users {
+		user := &users[i]
+
+		employee, err := employeeForUser(user)
+
+		if err != nil {
+			return err
+		}
+
+		if employee != nil && employee.HiredAt.Valid {
+			estimates[user.ID] = append(estimates[user.ID], JoinDateEstimate{Source: JoinDateHireDate, At: employee.HiredAt.Time, Confidence: 0.5})
+		}
+
+		best, ok := bestJoinDate(estimates[user.ID])
+
+		if !ok || !improvesJoinDate(user, best) {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%.1f\n",
+			user.ID,
+			user.SomeName(),
+			user.CreatedAt.Format("2006-01-02"),
+			user.CreatedAtSource,
+			best.At.Format("2006-01-02"),
+			best.Source,
+			best.Confidence,
+		)
+
+		updated++
+
+		if !save {
+			continue
+		}
+
+		_, err = db.Exec(`
+			UPDATE users SET
+				created_at = $1,
+				created_at_source = $2,
+				created_at_confidence = $3
+			WHERE id = $4
+		`, best.At, best.Source, best.Confidence, user.ID)
+
+		if err != nil {
+			return errors.Wrapf(err, "backfilling join date of %s", user.SomeName())
+		}
+	}
+
+	err = w.Flush()
+
+	if err != nil {
+		return err
+	}
+
+	verb := "Would update"
+	if save {
+		verb = "Updated"
+	}
+
+	fmt.Printf("%s %d of %d join dates\n", verb, updated, len(users))
+
+	if !save && updated > 0 {
+		fmt.Println("Run again with --save to store them")
+	}
+
+	return nil
+}
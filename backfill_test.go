@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBestJoinDate(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2019, time.March, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		estimates []JoinDateEstimate
+		source    string
+	}{
+		{"none", nil, ""},
+		{
+			"most confident",
+			[]JoinDateEstimate{
+				{Source: JoinDateHireDate, At: day(1), Confidence: 0.5},
+				{Source: JoinDateChannelJoin, At: day(3), Confidence: 0.9},
+			},
+			JoinDateChannelJoin,
+		},
+		{
+			"earlier upper bound wins",
+			[]JoinDateEstimate{
+				{Source: JoinDateChannelJoin, At: day(10), Confidence: 0.9},
+				{Source: JoinDateFirstMessage, At: day(5), Confidence: 0.6, UpperBound: true},
+			},
+			JoinDateFirstMessage,
+		},
+		{
+			"later upper bound ignored",
+			[]JoinDateEstimate{
+				{Source: JoinDateProfileUpdate, At: day(20), Confidence: 0.1, UpperBound: true},
+				{Source: JoinDateHireDate, At: day(2), Confidence: 0.5},
+			},
+			JoinDateHireDate,
+		},
+	}
+
+	for _, test := range tests {
+		best, ok := bestJoinDate(test.estimates)
+
+		if ok != (test.source != "") || best.Source != test.source {
+			t.Errorf("%s: expected %q, got %q", test.name, test.source, best.Source)
+		}
+	}
+}
+
+func TestImprovesJoinDate(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2019, time.March, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	user := &User{CreatedAt: day(10), CreatedAtSource: JoinDateInit}
+
+	tests := []struct {
+		name     string
+		estimate JoinDateEstimate
+		improves bool
+	}{
+		{"later join", JoinDateEstimate{Source: JoinDateChannelJoin, At: day(20), Confidence: 0.9}, true},
+		{"earlier upper bound", JoinDateEstimate{Source: JoinDateFirstMessage, At: day(5), Confidence: 0.6, UpperBound: true}, true},
+		{"later upper bound", JoinDateEstimate{Source: JoinDateFirstMessage, At: day(15), Confidence: 0.6, UpperBound: true}, false},
+		{"later profile update", JoinDateEstimate{Source: JoinDateProfileUpdate, At: day(25), Confidence: 0.1, UpperBound: true}, false},
+	}
+
+	for _, test := range tests {
+		if improvesJoinDate(user, test.estimate) != test.improves {
+			t.Errorf("%s: expected improves to be %v", test.name, test.improves)
+		}
+	}
+
+	observed := &User{CreatedAt: day(10), CreatedAtSource: JoinDateObserved, CreatedAtConfidence: 1}
+
+	if improvesJoinDate(observed, JoinDateEstimate{Source: JoinDateChannelJoin, At: day(1), Confidence: 0.9}) {
+		t.Error("expected a less confident estimate not to replace an observed join date")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// bambooHRDirectory gets employees from a BambooHR style custom report. URL is the company's API
+// root e.g. https://api.bamboohr.com/api/gateway.php/acme
+type bambooHRDirectory struct {
+	URL    string
+	APIKey string
+}
+
+var bambooHRFields = []string{
+	"id",
+	"displayName",
+	"firstName",
+	"lastName",
+	"supervisorEId",
+	"workEmail",
+	"jobTitle",
+	"department",
+	"location",
+	"hireDate",
+	"photoUrl",
+}
+
+type bambooHREmployee struct {
+	ID            string `json:"id"`
+	DisplayName   string `json:"displayName"`
+	FirstName     string `json:"firstName"`
+	LastName      string `json:"lastName"`
+	SupervisorEID string `json:"supervisorEId"`
+	WorkEmail     string `json:"workEmail"`
+	JobTitle      string `json:"jobTitle"`
+	Department    string `json:"department"`
+	Location      string `json:"location"`
+	HireDate      string `json:"hireDate"`
+	PhotoURL      string `json:"photoUrl"`
+}
+
+func (directory bambooHRDirectory) Employees() ([]*Employee, error) {
+	if directory.URL == "" || directory.APIKey == "" {
+		return nil, errors.New("the bamboohr directory needs BAMBOOHR_URL and BAMBOOHR_API_KEY")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"fields": bambooHRFields})
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(directory.URL, "/")+"/v1/reports/custom?format=JSON&onlyCurrent=true", bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// BambooHR uses the api key as the username, the password can be anything
+	req.SetBasicAuth(directory.APIKey, "x")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "requesting bamboohr report")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("requesting bamboohr report, expected 200 status but got %d: %s", resp.StatusCode, message)
+	}
+
+	report := struct {
+		Employees []bambooHREmployee `json:"employees"`
+	}{}
+
+	err = json.NewDecoder(resp.Body).Decode(&report)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding bamboohr report")
+	}
+
+	employees := []*Employee{}
+
+	for _, e := range report.Employees {
+		name := e.DisplayName
+		if name == "" {
+			name = strings.TrimSpace(e.FirstName + " " + e.LastName)
+		}
+
+		employees = append(employees, &Employee{
+			ID:           e.ID,
+			Name:         name,
+			SupervisorID: e.SupervisorEID,
+			Email:        e.WorkEmail,
+			Title:        e.JobTitle,
+			Department:   e.Department,
+			Location:     e.Location,
+			HiredAt:      parseHireDate(e.HireDate),
+			PhotoURL:     e.PhotoURL,
+		})
+	}
+
+	return countReports(employees), nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+// Chat tools other than slack take messages through incoming webhooks, chatWebhookEnv is where
+// each one's webhook comes from when it's the --messenger
+var chatWebhookEnv = map[string]string{
+	"teams":      "TEAMS_WEBHOOK_URL",
+	"discord":    "DISCORD_WEBHOOK_URL",
+	"mattermost": "MATTERMOST_WEBHOOK_URL",
+}
+
+func newChatMessenger(kind string) (messageFunc, error) {
+	url := os.Getenv(chatWebhookEnv[kind])
+
+	if url == "" {
+		return nil, fmt.Errorf("the %s messenger needs %s", kind, chatWebhookEnv[kind])
+	}
+
+	return channelMessengers[kind](url), nil
+}
+
+// messageAvatar is the picture of who a message is about, if there is one
+func messageAvatar(message Message) string {
+	if message.Event == nil {
+		return ""
+	}
+
+	if message.Event.User != nil {
+		return message.Event.User.Avatar
+	}
+
+	if message.Event.Employee != nil {
+		return message.Event.Employee.PhotoURL
+	}
+
+	return ""
+}
+
+// messageImages are the attachments' images other than the avatar
+func messageImages(message Message) []string {
+	avatar := messageAvatar(message)
+	urls := []string{}
+
+	for _, attachment := range message.Attachments {
+		if attachment.ImageURL != "" && attachment.ImageURL != avatar {
+			urls = append(urls, attachment.ImageURL)
+		}
+	}
+
+	return urls
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+
+	return string([]rune(s)[:max-1]) + "…"
+}
+
+type adaptiveElement map[string]interface{}
+
+// teamsPayload is an adaptive card, with the avatar beside the text
+func teamsPayload(message Message) map[string]interface{} {
+	text := adaptiveElement{"type": "TextBlock", "text": message.Text, "wrap": true}
+	body := []adaptiveElement{text}
+
+	if avatar := messageAvatar(message); avatar != "" {
+		body = []adaptiveElement{{
+			"type": "ColumnSet",
+			"columns": []adaptiveElement{
+				{
+					"type":  "Column",
+					"width": "auto",
+					"items": []adaptiveElement{{"type": "Image", "url": avatar, "size": "Small", "style": "Person"}},
+				},
+				{
+					"type":  "Column",
+					"width": "stretch",
+					"items": []adaptiveElement{text},
+				},
+			},
+		}}
+	}
+
+	for _, url := range messageImages(message) {
+		body = append(body, adaptiveElement{"type": "Image", "url": url})
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.2",
+					"body":    body,
+				},
+			},
+		},
+	}
+}
+
+func newTeamsMessenger(url string) messageFunc {
+	client := newWebhookClient()
+
+	return func(message Message) error {
+		err := client.PostJSON(url, teamsPayload(message))
+		return errors.Wrap(err, "sending a teams message")
+	}
+}
+
+type discordImage struct {
+	URL string `json:"url"`
+}
+
+type discordEmbed struct {
+	Description string        `json:"description,omitempty"`
+	Thumbnail   *discordImage `json:"thumbnail,omitempty"`
+	Image       *discordImage `json:"image,omitempty"`
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds,omitempty"`
+}
+
+// Discord won't take more than 4096 characters in an embed, or 10 embeds in a message
+const (
+	maxDiscordDescription = 4096
+	maxDiscordEmbeds      = 10
+)
+
+// discordPayload puts the text in an embed with the avatar as its thumbnail, and any other
+// images in embeds after it
+func discordPayload(message Message) discordMessage {
+	embed := discordEmbed{Description: truncate(message.Text, maxDiscordDescription)}
+
+	if avatar := messageAvatar(message); avatar != "" {
+		embed.Thumbnail = &discordImage{URL: avatar}
+	}
+
+	embeds := []discordEmbed{embed}
+
+	for _, url := range messageImages(message) {
+		if len(embeds) == maxDiscordEmbeds {
+			break
+		}
+
+		embeds = append(embeds, discordEmbed{Image: &discordImage{URL: url}})
+	}
+
+	return discordMessage{Username: "trail", Embeds: embeds}
+}
+
+func newDiscordMessenger(url string) messageFunc {
+	client := newWebhookClient()
+
+	return func(message Message) error {
+		err := client.PostJSON(url, discordPayload(message))
+		return errors.Wrap(err, "sending a discord message")
+	}
+}
+
+type mattermostMessage struct {
+	Username    string             `json:"username"`
+	IconEmoji   string             `json:"icon_emoji,omitempty"`
+	Text        string             `json:"text"`
+	Attachments []slack.Attachment `json:"attachments,omitempty"`
+}
+
+// mattermostPayload is much like a slack message, mattermost takes the same attachments and
+// knows the same emoji
+func mattermostPayload(message Message) mattermostMessage {
+	return mattermostMessage{
+		Username:    "trail",
+		IconEmoji:   strings.Trim(message.Emoji, ":"),
+		Text:        message.Text,
+		Attachments: message.Attachments,
+	}
+}
+
+func newMattermostMessenger(url string) messageFunc {
+	client := newWebhookClient()
+
+	return func(message Message) error {
+		err := client.PostJSON(url, mattermostPayload(message))
+		return errors.Wrap(err, "sending a mattermost message")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func deathMessage() Message {
+	user := &User{ID: "U1", RealName: "Zach Taylor", Avatar: "https://example.com/zach.png"}
+	event := userEvent(EventDeath, user, ":rip:", "Zach Taylor died of Dysentery")
+
+	return Message{
+		Text:  event.Text,
+		Emoji: event.Emoji,
+		Event: event,
+		Attachments: []slack.Attachment{
+			{ImageURL: user.Avatar},
+			{ImageURL: "https://example.com/grave.png"},
+		},
+	}
+}
+
+func TestTeamsMessenger(t *testing.T) {
+	server := newFakeReceiver(t)
+	defer server.Close()
+
+	err := newTeamsMessenger(server.URL)(deathMessage())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := server.Bodies()
+
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 post, got %d", len(bodies))
+	}
+
+	card := struct {
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type string                   `json:"type"`
+				Body []map[string]interface{} `json:"body"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}{}
+
+	if err := json.Unmarshal([]byte(bodies[0]), &card); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(card.Attachments) != 1 || card.Attachments[0].Content.Type != "AdaptiveCard" {
+		t.Fatalf("expected an adaptive card, got %s", bodies[0])
+	}
+
+	body := card.Attachments[0].Content.Body
+
+	if len(body) != 2 || body[0]["type"] != "ColumnSet" || body[1]["url"] != "https://example.com/grave.png" {
+		t.Errorf("expected the avatar beside the text then the grave, got %s", bodies[0])
+	}
+
+	if !strings.Contains(bodies[0], "died of Dysentery") {
+		t.Errorf("expected the text in the card, got %s", bodies[0])
+	}
+}
+
+func TestDiscordMessenger(t *testing.T) {
+	server := newFakeReceiver(t)
+	defer server.Close()
+
+	err := newDiscordMessenger(server.URL)(deathMessage())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := server.Bodies()
+
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 post, got %d", len(bodies))
+	}
+
+	message := discordMessage{}
+
+	if err := json.Unmarshal([]byte(bodies[0]), &message); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(message.Embeds) != 2 {
+		t.Fatalf("expected an embed for the text and one for the grave, got %s", bodies[0])
+	}
+
+	embed := message.Embeds[0]
+
+	if embed.Description != "Zach Taylor died of Dysentery" || embed.Thumbnail == nil || embed.Thumbnail.URL != "https://example.com/zach.png" {
+		t.Errorf("expected the avatar as the thumbnail, got %s", bodies[0])
+	}
+
+	long := discordPayload(Message{Text: strings.Repeat("a", maxDiscordDescription+1)})
+
+	if len(long.Embeds[0].Description) != maxDiscordDescription+2 || !strings.HasSuffix(long.Embeds[0].Description, "…") {
+		t.Errorf("expected a long description to be truncated, got %d characters", len(long.Embeds[0].Description))
+	}
+}
+
+func TestMattermostMessenger(t *testing.T) {
+	server := newFakeReceiver(t)
+	defer server.Close()
+
+	err := newMattermostMessenger(server.URL)(deathMessage())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := server.Bodies()
+
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 post, got %d", len(bodies))
+	}
+
+	message := mattermostMessage{}
+
+	if err := json.Unmarshal([]byte(bodies[0]), &message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.IconEmoji != "rip" || message.Text != "Zach Taylor died of Dysentery" || len(message.Attachments) != 2 {
+		t.Errorf("unexpected mattermost message %s", bodies[0])
+	}
+}
+
+func TestWithMessengerChannels(t *testing.T) {
+	server := newFakeReceiver(t)
+	defer server.Close()
+
+	sent := []Message{}
+	send := withMessengerChannels(func(message Message) error {
+		sent = append(sent, message)
+		return nil
+	})
+
+	for _, channel := range []string{"C0123", "discord:" + server.URL, "nope:" + server.URL} {
+		if err := send(Message{Channel: channel, Text: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if bodies := server.Bodies(); len(bodies) != 1 || !strings.Contains(bodies[0], "embeds") {
+		t.Errorf("expected the discord channel to go to discord, got %v", bodies)
+	}
+
+	if len(sent) != 2 || sent[0].Channel != "C0123" || sent[1].Channel != "nope:"+server.URL {
+		t.Errorf("expected other channels to go to the messenger, got %#v", sent)
+	}
+}
+
+func TestWithMessengerChannelsReusesMessengers(t *testing.T) {
+	made := 0
+	newDiscord := channelMessengers["discord"]
+
+	channelMessengers["discord"] = func(destination string) messageFunc {
+		made++
+		return func(Message) error { return nil }
+	}
+
+	defer func() { channelMessengers["discord"] = newDiscord }()
+
+	send := withMessengerChannels(func(Message) error { return nil })
+
+	for _, channel := range []string{"discord:a", "discord:a", "discord:b", "discord:a"} {
+		if err := send(Message{Channel: channel, Text: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if made != 2 {
+		t.Errorf("expected a messenger for each of the 2 channels, got %d", made)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// loadConfig decodes json config given either inline or as a path to a file. Lambdas only ship
+// the binary, so there they're set inline in an env var.
+func loadConfig(value string, v interface{}) error {
+	data := []byte(value)
+
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var err error
+		data, err = ioutil.ReadFile(value)
+
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", value)
+		}
+	}
+
+	return errors.Wrap(json.Unmarshal(data, v), "decoding config")
+}
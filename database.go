@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"log"
 	"os"
 
@@ -9,18 +10,33 @@ import (
 	_ "github.com/lib/pq"
 )
 
-var db *sqlx.DB
+// database is what *sqlx.DB and *sqlx.Tx have in common, so a dry run can swap in a transaction
+// that's never committed
+type database interface {
+	sqlx.Ext
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	NamedExec(query string, arg interface{}) (sql.Result, error)
+	NamedQuery(query string, arg interface{}) (*sqlx.Rows, error)
+}
+
+var (
+	db         database
+	connection *sqlx.DB
+)
 
 func init() {
 	// this Pings the database trying to connect, panics on error
 	// use sqlx.Open() for sql.Open() semantics
 	var err error
-	db, err = sqlx.Connect("postgres", os.Getenv("DATABASE_URL"))
+	connection, err = sqlx.Connect("postgres", os.Getenv("DATABASE_URL"))
 	if err != nil {
 		sentry.CaptureException(err)
 		log.Fatalln(err) // TODO: Report this error to sentry?!?
 	}
 
+	db = connection
+
 	// exec the schema or fail; multi-statement Exec behavior varies between
 	// database drivers;  pq will exec them all, sqlite3 won't, ymmv
 	// db.MustExec(schema)
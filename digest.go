@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+// DigestConfig is how often a channel gets a trail report instead of a message for every event.
+// Immediate event kinds are still announced right away.
+type DigestConfig struct {
+	Every     string   `json:"every"`
+	Immediate []string `json:"immediate"`
+}
+
+// digests are keyed by channel, channels without one get every event as it happens, see the
+// --digests flag
+var digests = map[string]DigestConfig{}
+
+func loadDigests(config string) (map[string]DigestConfig, error) {
+	configs := map[string]DigestConfig{}
+
+	if config == "" {
+		return configs, nil
+	}
+
+	err := loadConfig(config, &configs)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "loading digests")
+	}
+
+	for channel, config := range configs {
+		if config.Period() == 0 {
+			return nil, fmt.Errorf("digest for %s should be every day or week, got %q", channel, config.Every)
+		}
+	}
+
+	return configs, nil
+}
+
+func (config DigestConfig) Period() time.Duration {
+	switch config.Every {
+	case "day", "daily":
+		return 24 * time.Hour
+	case "week", "weekly":
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// holdsForDigest is whether an event kind waits for the channel's trail report
+func holdsForDigest(channel, kind string) bool {
+	config, ok := digests[channel]
+
+	return ok && !containsString(config.Immediate, kind)
+}
+
+func holdForDigest(event *Event, channel string) error {
+	_, err := db.Exec("INSERT INTO digest_items (event_id, channel) VALUES ($1, $2) ON CONFLICT DO NOTHING", event.ID, channel)
+
+	return errors.Wrapf(err, "holding event %d for the %s digest", event.ID, channel)
+}
+
+func pendingDigest(channel string) ([]Event, error) {
+	events := []Event{}
+
+	err := db.Select(&events, `
+		SELECT events.* FROM events
+		JOIN digest_items ON digest_items.event_id = events.id
+		WHERE digest_items.channel = $1 AND digest_items.digested_at IS NULL
+		ORDER BY events.created_at
+	`, channel)
+
+	return events, errors.Wrapf(err, "selecting pending digest for %s", channel)
+}
+
+func lastDigest(channel string) (pq.NullTime, error) {
+	last := pq.NullTime{}
+
+	err := db.Get(&last, "SELECT max(digested_at) FROM digest_items WHERE channel = $1", channel)
+
+	if err == sql.ErrNoRows {
+		return last, nil
+	}
+
+	return last, errors.Wrapf(err, "finding last digest for %s", channel)
+}
+
+// reportSection is a heading in the trail report and the kinds of event under it
+type reportSection struct {
+	Heading string
+	Kinds   []string
+	Grid    bool
+}
+
+var reportSections = []reportSection{
+	{Heading: ":baby: Births", Kinds: []string{EventBirth}},
+	{Heading: ":rip: Deaths", Kinds: []string{EventDeath, EventNecromance}},
+	{Heading: ":name_badge: Renames", Kinds: []string{EventRename, EventUserTitle, EventStatus}},
+	{Heading: ":heavy_plus_sign: New emoji", Kinds: []string{EventEmojiAdded}, Grid: true},
+	{Heading: ":heavy_minus_sign: Retired emoji", Kinds: []string{EventEmojiRemoved}, Grid: true},
+	{Heading: ":tada: Hires and departures", Kinds: []string{EventHire, EventDeparture, EventRehire}},
+	{Heading: ":twisted_rightwards_arrows: Org moves", Kinds: []string{EventReorg, EventSupervisor, EventReports, EventTitle, EventDepartment, EventLocation}},
+	{Heading: ":birthday: Milestones", Kinds: []string{EventAnniversary, EventLandmark}},
+}
+
+// Slack won't take more than 3000 characters in a section
+const maxSectionLength = 2900
+
+// sectionText lists events one per line, or emoji side by side as a grid
+func sectionText(events []Event, grid bool) string {
+	separator := "\n"
+	if grid {
+		separator = " "
+	}
+
+	text := ""
+
+	for i, event := range events {
+		line := event.Text
+		if !grid {
+			line = "• " + line
+		}
+
+		if len(text)+len(line) > maxSectionLength {
+			return fmt.Sprintf("%s\n…and %d more", text, len(events)-i)
+		}
+
+		if text != "" {
+			text += separator
+		}
+
+		text += line
+	}
+
+	return text
+}
+
+// trailReport sums up a batch of events as one message
+func trailReport(events []Event, from, to time.Time) Message {
+	title := fmt.Sprintf("Trail Report for %s", from.Format("Jan 2"))
+	if to.Format("2006-01-02") != from.Format("2006-01-02") {
+		title = fmt.Sprintf("Trail Report for %s to %s", from.Format("Jan 2"), to.Format("Jan 2"))
+	}
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*"+title+"*", false, false), nil, nil),
+	}
+	lines := []string{title}
+
+	sectioned := map[string]bool{}
+	sections := append([]reportSection{}, reportSections...)
+
+	for _, section := range reportSections {
+		for _, kind := range section.Kinds {
+			sectioned[kind] = true
+		}
+	}
+
+	sections = append(sections, reportSection{Heading: ":scroll: Everything else"})
+
+	for _, section := range sections {
+		matching := []Event{}
+
+		for _, event := range events {
+			if containsString(section.Kinds, event.Kind) || (section.Kinds == nil && !sectioned[event.Kind]) {
+				matching = append(matching, event)
+			}
+		}
+
+		if len(matching) == 0 {
+			continue
+		}
+
+		text := sectionText(matching, section.Grid)
+
+		blocks = append(blocks,
+			slack.NewDividerBlock(),
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", section.Heading, text), false, false), nil, nil),
+		)
+		lines = append(lines, "", section.Heading, text)
+	}
+
+	return Message{
+		Text:   strings.Join(lines, "\n"),
+		Emoji:  ":newspaper:",
+		Blocks: blocks,
+	}
+}
+
+func runDigestIteration(force bool) error {
+	for channel, config := range digests {
+		last, err := lastDigest(channel)
+
+		if err != nil {
+			return err
+		}
+
+		// An hour early is close enough, so a scheduled run that's a little fast doesn't skip a day
+		if !force && last.Valid && time.Since(last.Time) < config.Period()-time.Hour {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Not time for the %s digest, the last was %s\n", channel, last.Time)
+			}
+			continue
+		}
+
+		events, err := pendingDigest(channel)
+
+		if err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			continue
+		}
+
+		report := trailReport(events, events[0].CreatedAt, events[len(events)-1].CreatedAt)
+		report.Channel = channel
+
+		err = sendMessage(report)
+
+		if err != nil {
+			return errors.Wrapf(err, "sending the %s digest", channel)
+		}
+
+		ids := []int64{}
+
+		for _, event := range events {
+			ids = append(ids, int64(event.ID))
+		}
+
+		_, err = db.Exec("UPDATE digest_items SET digested_at = now() WHERE channel = $1 AND event_id = ANY($2)", channel, pq.Int64Array(ids))
+
+		if err != nil {
+			return errors.Wrapf(err, "marking the %s digest sent", channel)
+		}
+	}
+
+	return nil
+}
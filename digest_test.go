@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDigests(t *testing.T) {
+	configs, err := loadDigests(`{"C1": {"every": "weekly", "immediate": ["death"]}}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if configs["C1"].Period() != 7*24*time.Hour {
+		t.Errorf("expected a weekly digest, got %#v", configs["C1"])
+	}
+
+	if _, err := loadDigests(`{"C1": {"every": "fortnight"}}`); err == nil {
+		t.Errorf("expected an error for an unknown period")
+	}
+
+	digests = configs
+	defer func() { digests = map[string]DigestConfig{} }()
+
+	if !holdsForDigest("C1", EventBirth) {
+		t.Errorf("expected births to wait for the digest")
+	}
+
+	if holdsForDigest("C1", EventDeath) {
+		t.Errorf("expected deaths to be announced immediately")
+	}
+
+	if holdsForDigest("C2", EventBirth) {
+		t.Errorf("expected channels without a digest to get every event")
+	}
+}
+
+func TestTrailReport(t *testing.T) {
+	day := time.Date(2020, time.March, 2, 9, 0, 0, 0, time.UTC)
+
+	events := []Event{
+		{Kind: EventBirth, Text: "Congratulations, you have a beautiful new baby named Zach"},
+		{Kind: EventEmojiAdded, Text: ":party_parrot:"},
+		{Kind: EventEmojiAdded, Text: ":wagon:"},
+		{Kind: EventSupervisor, Text: "Zach's supervisor changed from Ann to Bob"},
+		{Kind: "mystery", Text: "Something else happened"},
+	}
+
+	report := trailReport(events, day, day.AddDate(0, 0, 6))
+
+	for _, expected := range []string{
+		"Trail Report for Mar 2 to Mar 8",
+		":baby: Births\n• Congratulations",
+		":heavy_plus_sign: New emoji\n:party_parrot: :wagon:",
+		":twisted_rightwards_arrows: Org moves\n• Zach's supervisor",
+		":scroll: Everything else\n• Something else happened",
+	} {
+		if !strings.Contains(report.Text, expected) {
+			t.Errorf("expected the report to include %q, got\n%s", expected, report.Text)
+		}
+	}
+
+	if strings.Contains(report.Text, "Deaths") {
+		t.Errorf("expected empty sections to be left out, got\n%s", report.Text)
+	}
+
+	// A title, then a divider and section for each of the 4 sections with events
+	if len(report.Blocks) != 9 {
+		t.Errorf("expected 9 blocks, got %d", len(report.Blocks))
+	}
+
+	if single := trailReport(events, day, day.Add(time.Hour)); !strings.HasPrefix(single.Text, "Trail Report for Mar 2\n") {
+		t.Errorf("expected a single day title, got %s", single.Text)
+	}
+}
+
+func TestSectionTextTruncates(t *testing.T) {
+	events := []Event{}
+
+	for i := 0; i < 200; i++ {
+		events = append(events, Event{Text: strings.Repeat("x", 50)})
+	}
+
+	text := sectionText(events, false)
+
+	if len(text) > 3000 || !strings.HasSuffix(text, "more") {
+		t.Errorf("expected a truncated section under 3000 characters, got %d characters", len(text))
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// DirectoryProvider is an HR system we can get every current employee from
+type DirectoryProvider interface {
+	Employees() ([]*Employee, error)
+}
+
+// directory is where the employees detector gets its employees, see the --directory flag
+var directory DirectoryProvider
+
+func newDirectoryProvider(kind, file string) (DirectoryProvider, error) {
+	switch kind {
+	case "ultipro":
+		return ultiproDirectory{}, nil
+	case "bamboohr":
+		return bambooHRDirectory{
+			URL:    os.Getenv("BAMBOOHR_URL"),
+			APIKey: os.Getenv("BAMBOOHR_API_KEY"),
+		}, nil
+	case "csv":
+		return csvDirectory{Path: file}, nil
+	case "ldif":
+		return ldifDirectory{Path: file}, nil
+	case "ldap":
+		return ldapDirectory{
+			URL:          os.Getenv("LDAP_URL"),
+			BindDN:       os.Getenv("LDAP_BIND_DN"),
+			BindPassword: os.Getenv("LDAP_BIND_PASSWORD"),
+			BaseDN:       os.Getenv("LDAP_BASE_DN"),
+			Filter:       os.Getenv("LDAP_FILTER"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported directory %s", kind)
+	}
+}
+
+type ultiproDirectory struct{}
+
+func (ultiproDirectory) Employees() ([]*Employee, error) {
+	return GetAllEmployees()
+}
+
+// parseHireDate understands the date formats HR systems export, an unparseable date is treated as
+// unknown
+func parseHireDate(s string) pq.NullTime {
+	for _, layout := range []string{"2006-01-02", "1/2/2006", "01/02/2006", "Jan 2, 2006", "20060102150405Z0700"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return pq.NullTime{Time: t, Valid: true}
+		}
+	}
+
+	return pq.NullTime{}
+}
+
+// countReports fills in ReportsCount for directories that only tell us who reports to who
+func countReports(employees []*Employee) []*Employee {
+	counts := map[string]int{}
+
+	for _, employee := range employees {
+		if employee.SupervisorID != "" {
+			counts[employee.SupervisorID]++
+		}
+	}
+
+	for _, employee := range employees {
+		employee.ReportsCount = counts[employee.ID]
+	}
+
+	return employees
+}
+
+// csvDirectory reads employees from a csv export with a header row. The id and name columns are
+// required, supervisor_id, email, title, department, location, hire_date and photo_url are
+// optional, and anything else is ignored.
+type csvDirectory struct {
+	Path string
+}
+
+func (directory csvDirectory) Employees() ([]*Employee, error) {
+	file, err := os.Open(directory.Path)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "opening csv directory")
+	}
+
+	defer file.Close()
+
+	return employeesFromCSV(file)
+}
+
+func employeesFromCSV(r io.Reader) ([]*Employee, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "reading csv header")
+	}
+
+	columns := map[string]int{}
+
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"id", "name"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv directory is missing the %s column", required)
+		}
+	}
+
+	employees := []*Employee{}
+
+	for {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(err, "reading csv record")
+		}
+
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		employees = append(employees, &Employee{
+			ID:           get("id"),
+			Name:         get("name"),
+			SupervisorID: get("supervisor_id"),
+			Email:        get("email"),
+			Title:        get("title"),
+			Department:   get("department"),
+			Location:     get("location"),
+			HiredAt:      parseHireDate(get("hire_date")),
+			PhotoURL:     get("photo_url"),
+		})
+	}
+
+	return countReports(employees), nil
+}
+
+// directoryEntry is a person from an LDAP style directory, keyed by DN with lowercased attribute
+// names
+type directoryEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+func (entry directoryEntry) Get(attribute string) string {
+	if values := entry.Attributes[strings.ToLower(attribute)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// employeesFromEntries maps LDAP style entries to employees. The employee id comes from the first
+// of employeeID, uid or the DN that's present, and manager DNs are resolved to those ids.
+func employeesFromEntries(entries []directoryEntry) []*Employee {
+	id := func(entry directoryEntry) string {
+		for _, attribute := range []string{"employeeID", "uid"} {
+			if value := entry.Get(attribute); value != "" {
+				return value
+			}
+		}
+		return entry.DN
+	}
+
+	ids := map[string]string{}
+
+	for _, entry := range entries {
+		ids[normalizeDN(entry.DN)] = id(entry)
+	}
+
+	employees := []*Employee{}
+
+	for _, entry := range entries {
+		name := entry.Get("displayName")
+		if name == "" {
+			name = entry.Get("cn")
+		}
+
+		employees = append(employees, &Employee{
+			ID:           id(entry),
+			Name:         name,
+			SupervisorID: ids[normalizeDN(entry.Get("manager"))],
+			Email:        entry.Get("mail"),
+			Title:        entry.Get("title"),
+			Department:   entry.Get("department"),
+			Location:     entry.Get("l"),
+		})
+	}
+
+	return countReports(employees)
+}
+
+// normalizeDN makes DNs comparable, they're case insensitive and may have spaces after commas
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func summarize(employees []*Employee) []string {
+	summary := []string{}
+
+	for _, e := range employees {
+		summary = append(summary, strings.Join([]string{e.ID, e.Name, e.SupervisorID, e.Email, strconv.Itoa(e.ReportsCount)}, "|"))
+	}
+
+	return summary
+}
+
+func TestEmployeesFromCSV(t *testing.T) {
+	employees, err := employeesFromCSV(strings.NewReader(`id,name,email,supervisor_id,shoe_size
+1,Adam Boss,adam@example.com,,11
+2,Jane Doe,jane@example.com,1,7
+`))
+
+	if err != nil {
+		t.Fatalf("Error reading csv %v", err)
+	}
+
+	expected := []string{"1|Adam Boss||adam@example.com|1", "2|Jane Doe|1|jane@example.com|0"}
+
+	if actual := summarize(employees); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func TestEmployeesFromLDIF(t *testing.T) {
+	entries, err := parseLDIF(strings.NewReader(`version: 1
+
+# the boss
+dn: uid=adam,ou=people,dc=example,dc=com
+objectClass: inetOrgPerson
+uid: adam
+cn: Adam Boss
+mail: adam@example.com
+
+dn: uid=jane,ou=people,dc=example,dc=com
+objectClass: inetOrgPerson
+uid: jane
+cn:: SmFuZSBEb2U=
+manager: uid=adam, ou=people,
+ dc=example,dc=com
+`))
+
+	if err != nil {
+		t.Fatalf("Error parsing ldif %v", err)
+	}
+
+	expected := []string{"adam|Adam Boss||adam@example.com|1", "jane|Jane Doe|adam||0"}
+
+	if actual := summarize(employeesFromEntries(entries)); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func TestIsPerson(t *testing.T) {
+	entry := func(control string, classes ...string) directoryEntry {
+		return directoryEntry{Attributes: map[string][]string{"objectclass": classes, "useraccountcontrol": {control}}}
+	}
+
+	cases := []struct {
+		entry    directoryEntry
+		expected bool
+	}{
+		{entry("", "top", "inetOrgPerson"), true},
+		{entry("512", "top", "person", "organizationalPerson", "user"), true},
+		{entry("514", "top", "person", "organizationalPerson", "user"), false},
+		{entry("4096", "top", "person", "organizationalPerson", "user", "computer"), false},
+		{entry("", "top", "group"), false},
+	}
+
+	for _, c := range cases {
+		if actual := isPerson(c.entry); actual != c.expected {
+			t.Errorf("Expected isPerson to be %t for %v, got %t", c.expected, c.entry.Attributes, actual)
+		}
+	}
+}
+
+func TestBambooHRDirectory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, _, _ := r.BasicAuth(); key != "secret" || r.URL.Path != "/acme/v1/reports/custom" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"employees": []map[string]string{
+				{"id": "1", "displayName": "Adam Boss"},
+				{"id": "2", "firstName": "Jane", "lastName": "Doe", "supervisorEId": "1", "workEmail": "jane@example.com"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	employees, err := bambooHRDirectory{URL: server.URL + "/acme", APIKey: "secret"}.Employees()
+
+	if err != nil {
+		t.Fatalf("Error getting employees %v", err)
+	}
+
+	expected := []string{"1|Adam Boss|||1", "2|Jane Doe|1|jane@example.com|0"}
+
+	if actual := summarize(employees); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
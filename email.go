@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const emailTimeout = 30 * time.Second
+
+// emailMessenger sends messages as email, with a plain text part and an html part that shows the
+// avatar of who it's about. Digest a channel like email:hr@example.com to batch events into a daily
+// or weekly email.
+type emailMessenger struct {
+	Addr     string // host:port of the smtp server
+	Username string
+	Password string
+	From     string
+	To       []string
+	// RequireTLS refuses to send over a connection that isn't encrypted, when the server doesn't
+	// offer STARTTLS. ImplicitTLS is for smtps, usually port 465, which is encrypted from the start.
+	RequireTLS  bool
+	ImplicitTLS bool
+	// TLSConfig is for STARTTLS and smtps
+	TLSConfig *tls.Config
+	// FetchAvatar gets an avatar to show inline, replaceable for testing
+	FetchAvatar func(url string) (*inlineImage, error)
+}
+
+// inlineImage is an image sent in the email itself, referenced from the html by its content id
+type inlineImage struct {
+	ContentID   string
+	ContentType string
+	Data        []byte
+}
+
+func newEmailMessenger(to string) (messageFunc, error) {
+	email := emailMessenger{
+		Addr:        os.Getenv("SMTP_ADDR"),
+		Username:    os.Getenv("SMTP_USERNAME"),
+		Password:    os.Getenv("SMTP_PASSWORD"),
+		From:        os.Getenv("EMAIL_FROM"),
+		RequireTLS:  os.Getenv("SMTP_REQUIRE_TLS") != "false",
+		FetchAvatar: fetchInlineImage,
+	}
+
+	if _, port, err := net.SplitHostPort(email.Addr); err == nil && port == "465" {
+		email.ImplicitTLS = true
+	}
+
+	for _, address := range strings.Split(to, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			email.To = append(email.To, address)
+		}
+	}
+
+	if email.Addr == "" || email.From == "" || len(email.To) == 0 {
+		return nil, errors.New("the email messenger needs SMTP_ADDR, EMAIL_FROM and EMAIL_TO")
+	}
+
+	return email.Send, nil
+}
+
+// newEmailMessengerTo is for email channels, they're only checked when a message is sent to one
+func newEmailMessengerTo(to string) messageFunc {
+	send, err := newEmailMessenger(to)
+
+	if err != nil {
+		return func(Message) error {
+			return err
+		}
+	}
+
+	return send
+}
+
+func (email emailMessenger) Send(message Message) error {
+	var avatar *inlineImage
+
+	if url := messageAvatar(message); url != "" && email.FetchAvatar != nil {
+		var err error
+		avatar, err = email.FetchAvatar(url)
+
+		// An email without a picture is better than no email
+		if err != nil && verbose {
+			fmt.Fprintf(os.Stderr, "Emailing without the avatar: %s\n", err)
+		}
+	}
+
+	body, err := buildEmail(email.From, email.To, message, avatar, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(email.send(body), "sending an email")
+}
+
+func (email emailMessenger) send(body []byte) error {
+	host, _, err := net.SplitHostPort(email.Addr)
+
+	if err != nil {
+		return errors.Wrapf(err, "parsing smtp address %s", email.Addr)
+	}
+
+	config := &tls.Config{ServerName: host}
+
+	if email.TLSConfig != nil {
+		config = email.TLSConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: emailTimeout}
+
+	var conn net.Conn
+
+	if email.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", email.Addr, config)
+	} else {
+		conn, err = dialer.Dial("tcp", email.Addr)
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "connecting to %s", email.Addr)
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+
+	if err != nil {
+		conn.Close()
+		return errors.Wrapf(err, "greeting %s", email.Addr)
+	}
+
+	defer client.Close()
+
+	if !email.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(config); err != nil {
+				return errors.Wrap(err, "starting tls")
+			}
+		} else if email.RequireTLS {
+			// NOTE: Trail reports are about people, they don't go out in the clear unless asked to
+			return fmt.Errorf("%s doesn't offer STARTTLS, set SMTP_REQUIRE_TLS=false to send without it", email.Addr)
+		}
+	}
+
+	// Plain auth refuses to send a password unencrypted, except to localhost
+	if email.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", email.Username, email.Password, host)); err != nil {
+			return errors.Wrap(err, "authenticating")
+		}
+	}
+
+	if err := client.Mail(email.From); err != nil {
+		return errors.Wrapf(err, "sending from %s", email.From)
+	}
+
+	for _, to := range email.To {
+		if err := client.Rcpt(to); err != nil {
+			return errors.Wrapf(err, "sending to %s", to)
+		}
+	}
+
+	w, err := client.Data()
+
+	if err != nil {
+		return errors.Wrap(err, "starting data")
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return errors.Wrap(err, "writing data")
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "finishing data")
+	}
+
+	return client.Quit()
+}
+
+// emailSubject is the first line of the message, which is the whole thing for most events and the
+// title of a trail report
+func emailSubject(text string) string {
+	return truncate(strings.SplitN(text, "\n", 2)[0], 100)
+}
+
+// emailHTML puts each paragraph of text in a <p>, with the avatar beside it
+func emailHTML(message Message, avatar *inlineImage) string {
+	b := &strings.Builder{}
+
+	b.WriteString("<!DOCTYPE html>\n<html><body style=\"font-family: sans-serif\">\n")
+
+	if avatar != nil {
+		fmt.Fprintf(b, "<img src=\"cid:%s\" alt=\"\" width=\"64\" height=\"64\" style=\"float: left; margin: 0 12px 12px 0; border-radius: 4px\">\n", avatar.ContentID)
+	}
+
+	for _, paragraph := range strings.Split(message.Text, "\n\n") {
+		lines := strings.Split(html.EscapeString(paragraph), "\n")
+		fmt.Fprintf(b, "<p>%s</p>\n", strings.Join(lines, "<br>\n"))
+	}
+
+	for _, url := range messageImages(message) {
+		fmt.Fprintf(b, "<p><img src=\"%s\" alt=\"\" style=\"max-width: 100%%\"></p>\n", html.EscapeString(url))
+	}
+
+	b.WriteString("</body></html>\n")
+
+	return b.String()
+}
+
+// buildEmail is a multipart/alternative email, and the html part is multipart/related when there's
+// an avatar to go with it
+func buildEmail(from string, to []string, message Message, avatar *inlineImage, now time.Time) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	alternative := multipart.NewWriter(buf)
+
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", emailSubject(message.Text)))
+	fmt.Fprintf(buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "Message-ID: %s\r\n", messageID(from, now))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", alternative.Boundary())
+
+	err := writeQuotedPrintable(alternative, "text/plain; charset=utf-8", message.Text)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := emailHTML(message, avatar)
+
+	if avatar == nil {
+		err = writeQuotedPrintable(alternative, "text/html; charset=utf-8", page)
+	} else {
+		err = writeRelated(alternative, page, avatar)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = alternative.Close()
+
+	return buf.Bytes(), errors.Wrap(err, "building email")
+}
+
+// messageID is unique to each email, at the domain it's from
+func messageID(from string, now time.Time) string {
+	domain := "trail"
+
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.TrimSuffix(from[i+1:], ">")
+	}
+
+	random := make([]byte, 8)
+	_, _ = rand.Read(random)
+
+	return fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), hex.EncodeToString(random), domain)
+}
+
+func writeQuotedPrintable(w *multipart.Writer, contentType, text string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "building email")
+	}
+
+	qp := quotedprintable.NewWriter(part)
+
+	if _, err := io.WriteString(qp, text); err != nil {
+		return errors.Wrap(err, "building email")
+	}
+
+	return errors.Wrap(qp.Close(), "building email")
+}
+
+func writeRelated(w *multipart.Writer, page string, image *inlineImage) error {
+	boundary := multipart.NewWriter(nil).Boundary()
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/related; boundary=" + boundary},
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "building email")
+	}
+
+	related := multipart.NewWriter(part)
+
+	if err := related.SetBoundary(boundary); err != nil {
+		return errors.Wrap(err, "building email")
+	}
+
+	if err := writeQuotedPrintable(related, "text/html; charset=utf-8", page); err != nil {
+		return err
+	}
+
+	imagePart, err := related.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {image.ContentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-ID":                {"<" + image.ContentID + ">"},
+		"Content-Disposition":       {"inline"},
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "building email")
+	}
+
+	// Lines in an email shouldn't be longer than 76 characters
+	encoded := base64.StdEncoding.EncodeToString(image.Data)
+
+	for len(encoded) > 76 {
+		fmt.Fprintf(imagePart, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+
+	fmt.Fprintf(imagePart, "%s\r\n", encoded)
+
+	return errors.Wrap(related.Close(), "building email")
+}
+
+// fetchInlineImage gets an avatar to attach to an email
+func fetchInlineImage(url string) (*inlineImage, error) {
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Get(url)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching image %s", url)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("fetching image %s, expected 200 status but got %d", url, resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading image %s", url)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+
+	return &inlineImage{ContentID: "avatar@trail", ContentType: contentType, Data: data}, nil
+}
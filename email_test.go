@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSink is just enough of an smtp server to receive one email, over STARTTLS when it has a
+// certificate, or over tls from the start when it's implicit
+type smtpSink struct {
+	Addr     string
+	TLS      *tls.Config
+	Implicit bool
+	Auth     chan string
+	Received chan string
+}
+
+func newSMTPSink(t *testing.T, config *tls.Config, implicit bool) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &smtpSink{Addr: listener.Addr().String(), TLS: config, Implicit: implicit, Auth: make(chan string, 1), Received: make(chan string, 1)}
+
+	go func() {
+		defer listener.Close()
+
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+		sink.serve(conn)
+	}()
+
+	return sink
+}
+
+func (sink *smtpSink) serve(conn net.Conn) {
+	secure := false
+
+	if sink.Implicit {
+		conn = tls.Server(conn, sink.TLS)
+		secure = true
+	}
+
+	text := textproto.NewConn(conn)
+
+	_ = text.PrintfLine("220 sink ready")
+
+	for {
+		line, err := text.ReadLine()
+
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO":
+			if sink.TLS != nil && !secure {
+				_ = text.PrintfLine("250-sink\r\n250 STARTTLS")
+			} else {
+				_ = text.PrintfLine("250-sink\r\n250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			_ = text.PrintfLine("220 go ahead")
+			conn = tls.Server(conn, sink.TLS)
+			text = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.Fields(line)[2])
+			sink.Auth <- string(credentials)
+			_ = text.PrintfLine("235 ok")
+		case "MAIL", "RCPT":
+			_ = text.PrintfLine("250 ok")
+		case "DATA":
+			_ = text.PrintfLine("354 go ahead")
+			data, _ := ioutil.ReadAll(text.DotReader())
+			sink.Received <- string(data)
+			_ = text.PrintfLine("250 ok")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestEmailMessenger(t *testing.T) {
+	// The test server's certificate is good for 127.0.0.1
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	sink := newSMTPSink(t, server.TLS, false)
+
+	email := emailMessenger{
+		Addr:       sink.Addr,
+		Username:   "trail",
+		Password:   "hunter2",
+		From:       "trail@example.com",
+		To:         []string{"hr@example.com"},
+		RequireTLS: true,
+		TLSConfig:  &tls.Config{RootCAs: roots},
+		FetchAvatar: func(url string) (*inlineImage, error) {
+			return &inlineImage{ContentID: "avatar@trail", ContentType: "image/png", Data: []byte("not really a png")}, nil
+		},
+	}
+
+	err := email.Send(deathMessage())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case credentials := <-sink.Auth:
+		if credentials != "\x00trail\x00hunter2" {
+			t.Errorf("unexpected credentials %q", credentials)
+		}
+	default:
+		t.Error("expected to authenticate")
+	}
+
+	received := <-sink.Received
+
+	message, err := mail.ReadMessage(strings.NewReader(received))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Header.Get("Subject") != "Zach Taylor died of Dysentery" || message.Header.Get("To") != "hr@example.com" {
+		t.Errorf("unexpected headers %v", message.Header)
+	}
+
+	if id := message.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("expected a message id at example.com, got %q", id)
+	}
+
+	parts := readParts(t, message.Header.Get("Content-Type"), message.Body)
+
+	if !strings.Contains(parts["text/plain"], "died of Dysentery") {
+		t.Errorf("expected a plain text part, got %v", parts)
+	}
+
+	if !strings.Contains(parts["text/html"], `src="cid:avatar@trail"`) || !strings.Contains(parts["text/html"], "grave.png") {
+		t.Errorf("expected html with the avatar inline and the grave, got %s", parts["text/html"])
+	}
+
+	if parts["image/png"] != "not really a png" {
+		t.Errorf("expected the avatar attached, got %q", parts["image/png"])
+	}
+}
+
+func TestEmailRequiresTLS(t *testing.T) {
+	sink := newSMTPSink(t, nil, false)
+
+	email := emailMessenger{Addr: sink.Addr, From: "trail@example.com", To: []string{"hr@example.com"}, RequireTLS: true}
+
+	if err := email.Send(Message{Text: "Trail Report"}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("expected to refuse sending without tls, got %v", err)
+	}
+
+	select {
+	case <-sink.Received:
+		t.Error("expected nothing to be sent in the clear")
+	default:
+	}
+}
+
+func TestEmailImplicitTLS(t *testing.T) {
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	sink := newSMTPSink(t, server.TLS, true)
+
+	email := emailMessenger{
+		Addr:        sink.Addr,
+		From:        "trail@example.com",
+		To:          []string{"hr@example.com"},
+		RequireTLS:  true,
+		ImplicitTLS: true,
+		TLSConfig:   &tls.Config{RootCAs: roots},
+	}
+
+	if err := email.Send(Message{Text: "Trail Report"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if received := <-sink.Received; !strings.Contains(received, "Trail Report") {
+		t.Errorf("expected the report, got %s", received)
+	}
+}
+
+// readParts flattens a multipart email into its parts' decoded content by type
+func readParts(t *testing.T, contentType string, body io.Reader) map[string]string {
+	parts := map[string]string{}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		t.Fatalf("expected multipart, got %s", mediaType)
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+
+	for {
+		part, err := reader.NextPart()
+
+		if err != nil {
+			break
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+
+		if strings.HasPrefix(partType, "multipart/") {
+			for k, v := range readParts(t, part.Header.Get("Content-Type"), part) {
+				parts[k] = v
+			}
+			continue
+		}
+
+		data, _ := ioutil.ReadAll(part)
+
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			data, _ = base64.StdEncoding.DecodeString(strings.NewReplacer("\r", "", "\n", "").Replace(string(data)))
+		}
+
+		parts[partType] = string(data)
+	}
+
+	return parts
+}
+
+func TestEmailHTML(t *testing.T) {
+	report := trailReport([]Event{
+		{Kind: EventBirth, Text: "Zach <Taylor> joined"},
+	}, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	page := emailHTML(report, nil)
+
+	if !strings.Contains(page, "<p>Trail Report for Jun 1</p>") || !strings.Contains(page, "Zach &lt;Taylor&gt; joined") {
+		t.Errorf("expected a paragraph for each section with escaped text, got %s", page)
+	}
+
+	if emailSubject(report.Text) != "Trail Report for Jun 1" {
+		t.Errorf("expected the report title as the subject, got %s", emailSubject(report.Text))
+	}
+
+	if !strings.Contains(page, "<br>") {
+		t.Errorf("expected lines broken within a section, got %s", page)
+	}
+}
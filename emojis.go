@@ -81,7 +81,7 @@ func diffEmojis(old, new []Emoji) error {
 
 	for _, emoji := range new {
 		if _, ok := oldLookup[emoji.Name]; !ok {
-			sendMessage(fmt.Sprintf(":%s:", emoji.Name), ":heavy_plus_sign:")
+			announce(&Event{Kind: EventEmojiAdded, Text: fmt.Sprintf(":%s:", emoji.Name), Emoji: ":heavy_plus_sign:"}, themedAttachments(ImageEmoji)...)
 
 			err := createEmoji(&emoji)
 
@@ -93,7 +93,7 @@ func diffEmojis(old, new []Emoji) error {
 
 	for _, emoji := range old {
 		if _, ok := newLookup[emoji.Name]; !ok {
-			sendMessage(fmt.Sprintf(":%s:", emoji.Name), ":heavy_minus_sign:")
+			announce(&Event{Kind: EventEmojiRemoved, Text: fmt.Sprintf(":%s:", emoji.Name), Emoji: ":heavy_minus_sign:"})
 
 			err := deleteEmoji(&emoji)
 
@@ -17,3 +17,74 @@ func TestEmployeeUpdate(t *testing.T) {
 	// 	t.Errorf("Error updating employee %v", err)
 	// }
 }
+
+func TestTitleRank(t *testing.T) {
+	promotions := [][2]string{
+		{"Software Engineer", "Senior Software Engineer"},
+		{"Sr. Software Engineer", "Engineering Manager"},
+		{"Engineering Manager", "Director of Engineering"},
+		{"Intern", "Software Engineer"},
+		{"Manager", "Senior Manager"},
+		{"Senior Manager", "Director"},
+		{"Staff Engineer", "Senior Staff Engineer"},
+		{"Senior Staff Engineer", "Principal Engineer"},
+		{"Associate Director", "Director"},
+		{"Senior Vice President", "Chief Technology Officer"},
+		{"Vice President of Sales", "President"},
+	}
+
+	for _, promotion := range promotions {
+		if titleRank(promotion[1]) <= titleRank(promotion[0]) {
+			t.Errorf("Expected %s to be a promotion from %s", promotion[1], promotion[0])
+		}
+	}
+
+	if titleRank("Senior Designer") > titleRank("Senior Software Engineer") {
+		t.Errorf("Expected a sideways move not to be a promotion")
+	}
+}
+
+func TestDeparturesAndRehires(t *testing.T) {
+	old := []*Employee{
+		{ID: "E1", Name: "Stays"},
+		{ID: "E2", Name: "Leaves"},
+		{ID: "E3", Name: "Already Gone", Deleted: true},
+		{ID: "E4", Name: "Comes Back", Deleted: true},
+	}
+
+	new := []*Employee{
+		{ID: "E1", Name: "Stays"},
+		{ID: "E4", Name: "Comes Back"},
+		{ID: "E5", Name: "New Hire"},
+	}
+
+	oldLookup := map[string]*Employee{}
+
+	for _, employee := range old {
+		oldLookup[employee.ID] = employee
+	}
+
+	departed := departures(old, new)
+
+	if len(departed) != 1 || departed[0].ID != "E2" {
+		t.Errorf("expected only E2 to depart, got %+v", departed)
+	}
+
+	rehired := rehires(oldLookup, new)
+
+	if len(rehired) != 1 || rehired[0].ID != "E4" {
+		t.Errorf("expected only E4 to be rehired, got %+v", rehired)
+	}
+
+	if err := checkFetchedEmployees([]*Employee{}); err == nil {
+		t.Error("expected zero fetched employees to be refused")
+	}
+
+	if err := checkFetchedEmployees(new); err != nil {
+		t.Errorf("expected fetched employees to be fine, got %v", err)
+	}
+
+	if len(departures(old, []*Employee{})) != 2 {
+		t.Error("expected an empty org chart to depart everyone, which is why it's refused")
+	}
+}
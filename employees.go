@@ -2,10 +2,15 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
 )
 
 type Employee struct {
@@ -13,11 +18,22 @@ type Employee struct {
 	Name         string      `db:"name"`
 	SupervisorID string      `db:"supervisor_id"`
 	ReportsCount int         `db:"reports_count"`
+	Email        string      `db:"email"`
+	Title        string      `db:"title"`
+	Department   string      `db:"department"`
+	Location     string      `db:"location"`
+	HiredAt      pq.NullTime `db:"hired_at"`
+	PhotoURL     string      `db:"photo_url"`
 	CreatedAt    time.Time   `db:"created_at"`
 	Deleted      bool        `db:"deleted"`
 	DeletedAt    pq.NullTime `db:"deleted_at"`
+	AnnouncedAt  pq.NullTime `db:"announced_at"`
 }
 
+// awaitSlack is how long to hold a new hire announcement waiting for a matching slack user, zero
+// means announce right away
+var awaitSlack time.Duration
+
 func FindEmployee(id string) (*Employee, error) {
 	var employee Employee
 	err := db.Get(&employee, "SELECT * FROM employees WHERE id = $1", id)
@@ -29,6 +45,8 @@ func FindEmployee(id string) (*Employee, error) {
 }
 
 func (employee *Employee) Update() error {
+	lookups.employees = nil
+
 	_, err := db.NamedExec(`
     UPDATE employees SET
 			name = :name
@@ -36,14 +54,25 @@ func (employee *Employee) Update() error {
 			, reports_count = :reports_count
 			, deleted = :deleted
 			, deleted_at = :deleted_at
+			, announced_at = :announced_at
+			, email = :email
+			, title = :title
+			, department = :department
+			, location = :location
+			, hired_at = :hired_at
+			, photo_url = :photo_url
 		WHERE
 		  id = :id
 	`, employee)
 
-	return errors.Wrapf(err, "updating employee %#v", employee)
+	if err != nil {
+		return errors.Wrapf(err, "updating employee %#v", employee)
+	}
+
+	return recordEmployeeVersion(employee, time.Now())
 }
 
-func (employee Employee) ChangeSupervisor(newSupervisorID string) error {
+func (employee *Employee) ChangeSupervisor(newSupervisorID string) error {
 	old, err := FindEmployee(employee.SupervisorID)
 	if err != nil {
 		return err
@@ -56,7 +85,7 @@ func (employee Employee) ChangeSupervisor(newSupervisorID string) error {
 
 	text := fmt.Sprintf("%s's supervisor changed from %s to %s", employee.Name, old.Name, new.Name)
 
-	err = sendMessage(text, ":name_badge:")
+	err = announce(employeeEvent(EventSupervisor, employee, ":name_badge:", text).Changed(employee.SupervisorID, newSupervisorID))
 
 	if err != nil {
 		return errors.Wrap(err, "sending name change message")
@@ -67,10 +96,10 @@ func (employee Employee) ChangeSupervisor(newSupervisorID string) error {
 	return employee.Update()
 }
 
-func (employee Employee) ChangeReportsCount(newCount int) error {
+func (employee *Employee) ChangeReportsCount(newCount int) error {
 	text := fmt.Sprintf("%s's reports changed from %d to %d", employee.Name, employee.ReportsCount, newCount)
 
-	err := sendMessage(text, ":name_badge:")
+	err := announce(employeeEvent(EventReports, employee, ":name_badge:", text).Changed(strconv.Itoa(employee.ReportsCount), strconv.Itoa(newCount)))
 	if err != nil {
 		return errors.Wrap(err, "sending reports count change message")
 	}
@@ -79,8 +108,209 @@ func (employee Employee) ChangeReportsCount(newCount int) error {
 	return employee.Update()
 }
 
+func (employee *Employee) Depart() error {
+	text := fmt.Sprintf("After %s, %s left the wagon party", employee.Age(), employee.Name)
+
+	err := announce(employeeEvent(EventDeparture, employee, ":wave:", text))
+
+	if err != nil {
+		return errors.Wrap(err, "sending departure message")
+	}
+
+	employee.Deleted = true
+	employee.DeletedAt = pq.NullTime{Time: time.Now(), Valid: true}
+
+	return employee.Update()
+}
+
+func (employee *Employee) Necromance() error {
+	text := fmt.Sprintf("%s is back from the dead!", employee.Name)
+
+	err := announce(employeeEvent(EventRehire, employee, ":zombie:", text))
+
+	if err != nil {
+		return errors.Wrap(err, "sending rehire message")
+	}
+
+	employee.Deleted = false
+	employee.DeletedAt = pq.NullTime{}
+
+	return employee.Update()
+}
+
+func (employee *Employee) Announce() error {
+	var attachments []slack.Attachment
+
+	user, err := userForEmployee(employee)
+
+	if err != nil {
+		return err
+	}
+
+	if user == nil && time.Since(employee.CreatedAt) < awaitSlack {
+		log.Printf("Holding announcement for %s until they show up in slack...\n", employee.Name)
+		return nil
+	}
+
+	if user != nil {
+		attachments = append(attachments, slack.Attachment{
+			ImageURL: user.Avatar,
+			Title:    "",
+		})
+	}
+
+	text := fmt.Sprintf("%s joined the wagon party", employee.Name)
+
+	if employee.SupervisorID != "" {
+		supervisor, err := FindEmployee(employee.SupervisorID)
+
+		if err != nil {
+			return errors.Wrapf(err, "finding supervisor of %s", employee.Name)
+		}
+
+		text = fmt.Sprintf("%s, riding with %s's team of %d", text, supervisor.Name, supervisor.ReportsCount)
+	}
+
+	err = announce(employeeEvent(EventHire, employee, ":tada:", text), attachments...)
+
+	if err != nil {
+		return errors.Wrap(err, "sending new hire message")
+	}
+
+	employee.AnnouncedAt = pq.NullTime{Time: time.Now(), Valid: true}
+
+	return employee.Update()
+}
+
+// FirstName handles both "First Last" and "Last, First" style names
+func (employee *Employee) FirstName() string {
+	if parts := strings.SplitN(employee.Name, ",", 2); len(parts) == 2 {
+		return firstWord(parts[1])
+	}
+
+	return firstWord(employee.Name)
+}
+
+func (employee *Employee) LastName() string {
+	if parts := strings.SplitN(employee.Name, ",", 2); len(parts) == 2 {
+		return strings.TrimSpace(parts[0])
+	}
+
+	parts := strings.Fields(employee.Name)
+	if len(parts) >= 2 {
+		return parts[len(parts)-1]
+	}
+	return ""
+}
+
+func firstWord(s string) string {
+	parts := strings.Fields(s)
+	if len(parts) >= 1 {
+		return parts[0]
+	}
+	return ""
+}
+
+func (employee *Employee) Age() time.Duration {
+	t := time.Now()
+
+	if employee.DeletedAt.Valid {
+		t = employee.DeletedAt.Time
+	}
+
+	return t.Sub(employee.CreatedAt)
+}
+
+func (employee *Employee) ChangeTitle(newTitle string) error {
+	text := fmt.Sprintf("%s changed their title from %s to %s", employee.Name, employee.Title, newTitle)
+	emoji := ":name_badge:"
+
+	if titleRank(newTitle) > titleRank(employee.Title) {
+		text = fmt.Sprintf("%s was promoted from %s to %s", employee.Name, employee.Title, newTitle)
+		emoji = ":medal:"
+	}
+
+	err := announce(employeeEvent(EventTitle, employee, emoji, text).Changed(employee.Title, newTitle))
+
+	if err != nil {
+		return errors.Wrap(err, "sending title change message")
+	}
+
+	employee.Title = newTitle
+
+	return employee.Update()
+}
+
+func (employee *Employee) ChangeDepartment(newDepartment string) error {
+	text := fmt.Sprintf("%s transferred from %s to %s", employee.Name, employee.Department, newDepartment)
+
+	err := announce(employeeEvent(EventDepartment, employee, ":twisted_rightwards_arrows:", text).Changed(employee.Department, newDepartment))
+
+	if err != nil {
+		return errors.Wrap(err, "sending department change message")
+	}
+
+	employee.Department = newDepartment
+
+	return employee.Update()
+}
+
+func (employee *Employee) ChangeLocation(newLocation string) error {
+	text := fmt.Sprintf("%s moved their wagon from %s to %s", employee.Name, employee.Location, newLocation)
+
+	err := announce(employeeEvent(EventLocation, employee, ":round_pushpin:", text).Changed(employee.Location, newLocation))
+
+	if err != nil {
+		return errors.Wrap(err, "sending location change message")
+	}
+
+	employee.Location = newLocation
+
+	return employee.Update()
+}
+
+// titleLevels are rough seniority keywords, most senior first
+var titleLevels = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(chief|ceo|cto|cfo|coo)\b|^president\b`),
+	regexp.MustCompile(`(?i)\b(vp|vice president)\b`),
+	regexp.MustCompile(`(?i)\b(director|head)\b`),
+	regexp.MustCompile(`(?i)\b(principal|manager)\b`),
+	regexp.MustCompile(`(?i)\b(staff|lead)\b`),
+	regexp.MustCompile(`(?i)\b(senior|sr)\b`),
+	regexp.MustCompile(`(?i)\b(junior|jr|associate|intern)\b`),
+}
+
+// titleRank guesses how senior a title is so title changes can be told apart from promotions,
+// higher is more senior. The most senior keyword picks the level, and any other keyword nudges the
+// title up or down within it, so "Senior Manager" is above "Manager" but still below "Director".
+func titleRank(title string) int {
+	rank, nudge := 0, 0
+
+	for i, level := range titleLevels {
+		if !level.MatchString(title) {
+			continue
+		}
+
+		if rank == 0 {
+			rank = (len(titleLevels) - i) * 2
+		} else if i == len(titleLevels)-1 {
+			nudge = -1
+		} else if nudge == 0 {
+			nudge = 1
+		}
+	}
+
+	if rank == 0 {
+		// Plain titles like "Software Engineer" sit between junior and senior
+		return 3
+	}
+
+	return rank + nudge
+}
+
 func createEmployee(employee *Employee) (*Employee, error) {
 	employee.CreatedAt = time.Now()
+	lookups.employees = nil
 
 	if employee.Deleted {
 		employee.DeletedAt = pq.NullTime{Time: time.Now(), Valid: true}
@@ -88,12 +318,16 @@ func createEmployee(employee *Employee) (*Employee, error) {
 
 	_, err := db.NamedExec(`
 		INSERT INTO employees
-		(id, name, reports_count, supervisor_id, created_at, deleted, deleted_at)
+		(id, name, reports_count, supervisor_id, created_at, deleted, deleted_at, announced_at, email, title, department, location, hired_at, photo_url)
 		VALUES
-		(:id, :name, :reports_count, :supervisor_id, :created_at, :deleted, :deleted_at)
+		(:id, :name, :reports_count, :supervisor_id, :created_at, :deleted, :deleted_at, :announced_at, :email, :title, :department, :location, :hired_at, :photo_url)
 		`, employee)
 
-	return employee, errors.Wrapf(err, "inserting employee %#v", employee)
+	if err != nil {
+		return employee, errors.Wrapf(err, "inserting employee %#v", employee)
+	}
+
+	return employee, recordEmployeeVersion(employee, employee.CreatedAt)
 }
 
 func runEmployeesIteration() error {
@@ -102,7 +336,12 @@ func runEmployeesIteration() error {
 		return err
 	}
 
-	newEmployees, err := GetAllEmployees()
+	newEmployees, err := directory.Employees()
+	if err != nil {
+		return err
+	}
+
+	err = checkFetchedEmployees(newEmployees)
 	if err != nil {
 		return err
 	}
@@ -119,9 +358,21 @@ func runEmployeesIteration() error {
 		return err
 	}
 
+	err = announceNewEmployees()
+
+	if err != nil {
+		return errors.Wrap(err, "announcing new employees")
+	}
+
 	err = diffEmployees(oldLookup, newEmployees)
 
-	return errors.Wrap(err, "diffing employees")
+	if err != nil {
+		return errors.Wrap(err, "diffing employees")
+	}
+
+	err = departEmployees(oldEmployees, newEmployees)
+
+	return errors.Wrap(err, "departing employees")
 }
 
 func createNewEmployees(oldLookup map[string]*Employee, newEmployees []*Employee) error {
@@ -141,21 +392,65 @@ func createNewEmployees(oldLookup map[string]*Employee, newEmployees []*Employee
 }
 
 func diffEmployees(oldLookup map[string]*Employee, new []*Employee) error {
+	moves := []OrgChange{}
+
+	for _, rehire := range rehires(oldLookup, new) {
+		err := rehire.Necromance()
+
+		if err != nil {
+			return fmt.Errorf("rehiring employee: %w\n%+v", err, rehire)
+		}
+	}
+
 	for _, newEmployee := range new {
 		if oldEmployee, ok := oldLookup[newEmployee.ID]; ok {
 			if newEmployee.SupervisorID != "" && newEmployee.SupervisorID != oldEmployee.SupervisorID {
-				err := oldEmployee.ChangeSupervisor(newEmployee.SupervisorID)
+				moves = append(moves, OrgChange{Kind: OrgChangeMoved, Before: oldEmployee, After: newEmployee})
+			}
+		}
+	}
 
-				if err != nil {
-					return fmt.Errorf("changing employees supervisor: %w\n%+v", err, newEmployee)
-				}
+	reorgs, moves := detectReorgs(moves, reorgThreshold)
+
+	err := announceReorgs(reorgs, reorgReportsChanges(reorgs, oldLookup, new))
+
+	if err != nil {
+		return errors.Wrap(err, "announcing reorgs")
+	}
+
+	for _, move := range moves {
+		err := move.Before.ChangeSupervisor(move.After.SupervisorID)
+
+		if err != nil {
+			return fmt.Errorf("changing employees supervisor: %w\n%+v", err, move.After)
+		}
+	}
+
+	for _, newEmployee := range new {
+		if oldEmployee, ok := oldLookup[newEmployee.ID]; ok {
+			err := diffEmployeeAttributes(oldEmployee, newEmployee)
+
+			if err != nil {
+				return fmt.Errorf("changing employees attributes: %w\n%+v", err, newEmployee)
+			}
+		}
+	}
+
+	// Report counts of supervisors involved in a reorg are part of the reorg message already
+	reorganized := reorganizedSupervisors(reorgs)
+
+	for _, newEmployee := range new {
+		if oldEmployee, ok := oldLookup[newEmployee.ID]; ok && newEmployee.ReportsCount != oldEmployee.ReportsCount {
+			var err error
+
+			if reorganized[oldEmployee.ID] {
+				err = changeReorganizedReportsCount(oldEmployee, newEmployee.ReportsCount)
+			} else {
+				err = oldEmployee.ChangeReportsCount(newEmployee.ReportsCount)
 			}
 
-			if newEmployee.ReportsCount != oldEmployee.ReportsCount {
-				err := oldEmployee.ChangeReportsCount(newEmployee.ReportsCount)
-				if err != nil {
-					return fmt.Errorf("changing employees reports count: %w\n%+v", err, newEmployee)
-				}
+			if err != nil {
+				return fmt.Errorf("changing employees reports count: %w\n%+v", err, newEmployee)
 			}
 		}
 	}
@@ -163,6 +458,151 @@ func diffEmployees(oldLookup map[string]*Employee, new []*Employee) error {
 	return nil
 }
 
+// diffEmployeeAttributes announces promotions, transfers and relocations. Attributes being filled in
+// for the first time, or that aren't worth a message, are updated quietly.
+func diffEmployeeAttributes(old, new *Employee) error {
+	if new.Title != old.Title && old.Title != "" && new.Title != "" {
+		err := old.ChangeTitle(new.Title)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if new.Department != old.Department && old.Department != "" && new.Department != "" {
+		err := old.ChangeDepartment(new.Department)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if new.Location != old.Location && old.Location != "" && new.Location != "" {
+		err := old.ChangeLocation(new.Location)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	quiet := false
+
+	for _, change := range []struct {
+		from *string
+		to   string
+	}{
+		{&old.Title, new.Title},
+		{&old.Department, new.Department},
+		{&old.Location, new.Location},
+	} {
+		if *change.from == "" && change.to != "" {
+			*change.from = change.to
+			quiet = true
+		}
+	}
+
+	if new.Email != "" && new.Email != old.Email {
+		old.Email = new.Email
+		quiet = true
+	}
+
+	if new.HiredAt.Valid && (!old.HiredAt.Valid || !new.HiredAt.Time.Equal(old.HiredAt.Time)) {
+		old.HiredAt = new.HiredAt
+		quiet = true
+	}
+
+	if new.PhotoURL != "" && new.PhotoURL != old.PhotoURL {
+		old.PhotoURL = new.PhotoURL
+		quiet = true
+	}
+
+	if !quiet {
+		return nil
+	}
+
+	return old.Update()
+}
+
+// announceNewEmployees says hello to every employee who hasn't been announced yet, which includes
+// anyone still waiting on a slack account from a previous run
+func announceNewEmployees() error {
+	employees := []*Employee{}
+
+	err := db.Select(&employees, "SELECT * FROM employees WHERE announced_at IS NULL AND NOT deleted")
+
+	if err != nil {
+		return errors.Wrap(err, "selecting unannounced employees")
+	}
+
+	for _, employee := range employees {
+		err := employee.Announce()
+
+		if err != nil {
+			return fmt.Errorf("announcing employee: %w\n%+v", err, employee)
+		}
+	}
+
+	return nil
+}
+
+// departEmployees marks employees we know about, but who are missing from the org chart, as
+// deleted
+func departEmployees(old []*Employee, new []*Employee) error {
+	for _, departure := range departures(old, new) {
+		err := departure.Depart()
+
+		if err != nil {
+			return fmt.Errorf("departing employee: %w\n%+v", err, departure)
+		}
+	}
+
+	return nil
+}
+
+// departures are employees we know about, who haven't already departed, missing from the org chart
+func departures(old []*Employee, new []*Employee) []*Employee {
+	newLookup := map[string]bool{}
+
+	for _, newEmployee := range new {
+		newLookup[newEmployee.ID] = true
+	}
+
+	departed := []*Employee{}
+
+	for _, oldEmployee := range old {
+		if oldEmployee.Deleted || newLookup[oldEmployee.ID] {
+			continue
+		}
+
+		departed = append(departed, oldEmployee)
+	}
+
+	return departed
+}
+
+// rehires are departed employees who are back in the org chart
+func rehires(oldLookup map[string]*Employee, new []*Employee) []*Employee {
+	rehired := []*Employee{}
+
+	for _, newEmployee := range new {
+		if oldEmployee, ok := oldLookup[newEmployee.ID]; ok && oldEmployee.Deleted {
+			rehired = append(rehired, oldEmployee)
+		}
+	}
+
+	return rehired
+}
+
+// checkFetchedEmployees refuses an empty org chart, which almost certainly means the fetch went
+// wrong, and treating it as real would announce every single employee as departed
+func checkFetchedEmployees(employees []*Employee) error {
+	if len(employees) == 0 {
+		return errors.New("fetched zero employees, refusing to mark everyone as departed")
+	}
+
+	return nil
+}
+
 func employeesFromDatabase() ([]*Employee, error) {
 	employees := []*Employee{}
 
@@ -176,13 +616,16 @@ func employeesFromDatabase() ([]*Employee, error) {
 }
 
 func initializeEmployees() error {
-	employees, err := GetAllEmployees()
+	employees, err := directory.Employees()
 
 	if err != nil {
 		return err
 	}
 
 	for _, e := range employees {
+		// Nobody is new during initialization
+		e.AnnouncedAt = pq.NullTime{Time: time.Now(), Valid: true}
+
 		_, err = createEmployee(e)
 
 		if err != nil {
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+// Event is something trail announced, kept so there's a history of what happened to who
+type Event struct {
+	ID         int            `db:"id"`
+	Kind       string         `db:"kind"`
+	UserID     sql.NullString `db:"user_id"`
+	EmployeeID sql.NullString `db:"employee_id"`
+	Text       string         `db:"text"`
+	Emoji      string         `db:"emoji"`
+	CreatedAt  time.Time      `db:"created_at"`
+	Old        string         `db:"old_value"`
+	New        string         `db:"new_value"`
+	// Set once every channel the event is routed to has it
+	DeliveredAt pq.NullTime `db:"delivered_at"`
+
+	// Who the event is about, for routing
+	User     *User     `db:"-"`
+	Employee *Employee `db:"-"`
+}
+
+// Kinds of event
+const (
+	EventBirth        = "birth"
+	EventDeath        = "death"
+	EventRename       = "rename"
+	EventStatus       = "status"
+	EventUserTitle    = "user_title"
+	EventNecromance   = "necromance"
+	EventAdmin        = "admin"
+	EventEmojiAdded   = "emoji_added"
+	EventEmojiRemoved = "emoji_removed"
+	EventHire         = "hire"
+	EventDeparture    = "departure"
+	EventRehire       = "rehire"
+	EventSupervisor   = "supervisor"
+	EventReports      = "reports"
+	EventTitle        = "title"
+	EventDepartment   = "department"
+	EventLocation     = "location"
+	EventReorg        = "reorg"
+	EventAnniversary  = "anniversary"
+	EventLandmark     = "landmark"
+)
+
+func userEvent(kind string, user *User, emoji, text string) *Event {
+	return &Event{
+		Kind:   kind,
+		UserID: sql.NullString{String: user.ID, Valid: true},
+		Text:   text,
+		Emoji:  emoji,
+		User:   user,
+	}
+}
+
+func employeeEvent(kind string, employee *Employee, emoji, text string) *Event {
+	return &Event{
+		Kind:       kind,
+		EmployeeID: sql.NullString{String: employee.ID, Valid: true},
+		Text:       text,
+		Emoji:      emoji,
+		Employee:   employee,
+	}
+}
+
+// Changed notes what an event changed from and to
+func (event *Event) Changed(old, new string) *Event {
+	event.Old = old
+	event.New = new
+	return event
+}
+
+// retryWindow is how long an event that wasn't delivered everywhere is picked back up by a retry,
+// rather than being recorded as something that happened again
+const retryWindow = 24 * time.Hour
+
+// announce records an event, then sends it to each channel it's routed to. Channels with a digest
+// hold the event for their trail report instead. Each channel is recorded as it gets the event, so
+// when a detector retries an event that failed part way, channels that already have it are skipped.
+func announce(event *Event, attachments ...slack.Attachment) error {
+	channels, err := eventChannels(event)
+
+	if err != nil {
+		return err
+	}
+
+	err = recordEvent(event)
+
+	if err != nil {
+		return err
+	}
+
+	delivered, err := eventDeliveries(event)
+
+	if err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		err := deliver(event, channel, holdsForDigest(channel, event.Kind), delivered, attachments)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Webhooks get every event, even ones that are quiet or held for a digest everywhere else
+	for _, url := range webhookURLs {
+		err := deliver(event, webhookChannel(url), false, delivered, attachments)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec("UPDATE events SET delivered_at = $1 WHERE id = $2", time.Now(), event.ID)
+
+	return errors.Wrapf(err, "marking event %d delivered", event.ID)
+}
+
+// deliver sends an event to a channel, or holds it for the channel's digest, unless the channel
+// already has it
+func deliver(event *Event, channel string, hold bool, delivered map[string]bool, attachments []slack.Attachment) error {
+	if delivered[channel] {
+		return nil
+	}
+
+	var err error
+
+	if hold {
+		err = holdForDigest(event, channel)
+	} else {
+		err = sendMessage(Message{
+			Channel:     channel,
+			Text:        event.Text,
+			Emoji:       event.Emoji,
+			Attachments: attachments,
+			Event:       event,
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	delivered[channel] = true
+
+	return recordDelivery(event, channel)
+}
+
+// recordEvent stores an event, unless an earlier attempt at the same event wasn't delivered
+// everywhere, in which case that's the event. Events about somebody are the same event when they
+// change the same thing, anything else has to say the same thing.
+func recordEvent(event *Event) error {
+	pending := Event{}
+
+	err := db.Get(&pending, `
+		SELECT * FROM events
+		WHERE
+			delivered_at IS NULL
+			AND created_at > $1
+			AND kind = $2
+			AND user_id IS NOT DISTINCT FROM $3
+			AND employee_id IS NOT DISTINCT FROM $4
+			AND old_value = $5
+			AND new_value = $6
+			AND (user_id IS NOT NULL OR employee_id IS NOT NULL OR text = $7)
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, time.Now().Add(-retryWindow), event.Kind, event.UserID, event.EmployeeID, event.Old, event.New, event.Text)
+
+	if err == sql.ErrNoRows {
+		return createEvent(event)
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "finding earlier attempts at event %#v", event)
+	}
+
+	// NOTE: The first attempt's text is kept, fates are random and every channel should hear the same one
+	event.ID = pending.ID
+	event.Text = pending.Text
+	event.Emoji = pending.Emoji
+	event.CreatedAt = pending.CreatedAt
+
+	return nil
+}
+
+func eventDeliveries(event *Event) (map[string]bool, error) {
+	channels := []string{}
+
+	err := db.Select(&channels, "SELECT channel FROM event_deliveries WHERE event_id = $1", event.ID)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "selecting deliveries of event %d", event.ID)
+	}
+
+	delivered := map[string]bool{}
+
+	for _, channel := range channels {
+		delivered[channel] = true
+	}
+
+	return delivered, nil
+}
+
+func recordDelivery(event *Event, channel string) error {
+	_, err := db.Exec(`
+		INSERT INTO event_deliveries
+		(event_id, channel, delivered_at)
+		VALUES
+		($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, event.ID, channel, time.Now())
+
+	return errors.Wrapf(err, "recording delivery of event %d to %s", event.ID, channel)
+}
+
+func createEvent(event *Event) error {
+	event.CreatedAt = time.Now()
+
+	rows, err := db.NamedQuery(`
+		INSERT INTO events
+		(kind, user_id, employee_id, text, emoji, created_at, old_value, new_value, delivered_at)
+		VALUES
+		(:kind, :user_id, :employee_id, :text, :emoji, :created_at, :old_value, :new_value, :delivered_at)
+		RETURNING id
+		`, event)
+
+	if err != nil {
+		return errors.Wrapf(err, "inserting event %#v", event)
+	}
+
+	defer rows.Close()
+
+	if rows.Next() {
+		err = rows.Scan(&event.ID)
+	}
+
+	return errors.Wrapf(err, "inserting event %#v", event)
+}
+
+// eventsFor is everything that happened to a slack user, and to the employee they're linked to
+func eventsFor(user *User, employee *Employee) ([]Event, error) {
+	employeeID := sql.NullString{}
+
+	if employee != nil {
+		employeeID = sql.NullString{String: employee.ID, Valid: true}
+	}
+
+	events := []Event{}
+
+	err := db.Select(&events, `
+		SELECT * FROM events
+		WHERE user_id = $1 OR employee_id = $2
+		ORDER BY created_at
+	`, user.ID, employeeID)
+
+	return events, errors.Wrapf(err, "selecting events for %s", user.SomeName())
+}
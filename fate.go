@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fate is one way to die on the trail. A fate is only possible when its conditions hold, months and
+// dates limit it to a season or holiday, and tenure limits it by how long someone lasted.
+type Fate struct {
+	Text          string   `json:"text"`
+	Weight        float64  `json:"weight"`
+	Months        []int    `json:"months"`
+	Dates         []string `json:"dates"` // e.g. 10-31
+	MinTenureDays int      `json:"min_tenure_days"`
+	MaxTenureDays int      `json:"max_tenure_days"`
+}
+
+// fates are what the deaths detector picks from, see the --fates flag
+var fates = defaultFates
+
+var defaultFates = []Fate{
+	{Text: "died of Dysentery"},
+	{Text: "died of Typhoid Fever"},
+	{Text: "died of Cholera"},
+	{Text: "died of Diphtheria"},
+	{Text: "died of Measles"},
+	{Text: "died of Thirst Traps"},
+	{Text: "drowned fording the river", Weight: 6, MaxTenureDays: 90},
+	{Text: "froze in the Blue Mountains", Months: []int{12, 1, 2}},
+	{Text: "was spooked to death by a ghost", Weight: 6, Dates: []string{"10-31"}},
+}
+
+func loadFates(value string) ([]Fate, error) {
+	if value == "" {
+		return defaultFates, nil
+	}
+
+	// A weight left out is an ordinary fate, but one that's there has to be positive, 0 doesn't
+	// mean never
+	config := struct {
+		Fates []struct {
+			Fate
+			Weight *float64 `json:"weight"`
+		} `json:"fates"`
+	}{}
+
+	err := loadConfig(value, &config)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "loading fates")
+	}
+
+	loaded := []Fate{}
+
+	for _, configured := range config.Fates {
+		fate := configured.Fate
+
+		if configured.Weight != nil {
+			if *configured.Weight <= 0 {
+				return nil, fmt.Errorf("fate weights should be positive, got %v for %s", *configured.Weight, fate.Text)
+			}
+
+			fate.Weight = *configured.Weight
+		}
+
+		if fate.Text == "" {
+			return nil, fmt.Errorf("fates need text, got %#v", fate)
+		}
+
+		for _, date := range fate.Dates {
+			if _, err := time.Parse("01-02", date); err != nil {
+				return nil, fmt.Errorf("fate dates should look like 10-31, got %s", date)
+			}
+		}
+
+		loaded = append(loaded, fate)
+	}
+
+	if len(loaded) == 0 {
+		return nil, errors.New("no fates in config")
+	}
+
+	return loaded, nil
+}
+
+func (fate Fate) Possible(today time.Time, tenure time.Duration) bool {
+	days := int(tenure.Hours() / 24)
+
+	if fate.MinTenureDays > 0 && days < fate.MinTenureDays {
+		return false
+	}
+
+	if fate.MaxTenureDays > 0 && days >= fate.MaxTenureDays {
+		return false
+	}
+
+	if len(fate.Months) > 0 && !containsInt(fate.Months, int(today.Month())) {
+		return false
+	}
+
+	if len(fate.Dates) > 0 && !containsString(fate.Dates, today.Format("01-02")) {
+		return false
+	}
+
+	return true
+}
+
+func (fate Fate) weight() float64 {
+	// Weights are optional in config, leaving one out means an ordinary fate
+	if fate.Weight == 0 {
+		return 1
+	}
+	return fate.Weight
+}
+
+// chooseFate picks from the possible fates by weight. It's seeded by the user's id so that running
+// again, like after a failed announcement, gives them the same fate.
+func chooseFate(fates []Fate, userID string, today time.Time, tenure time.Duration) string {
+	possible := []Fate{}
+	total := 0.0
+
+	for _, fate := range fates {
+		if fate.Possible(today, tenure) {
+			possible = append(possible, fate)
+			total += fate.weight()
+		}
+	}
+
+	if len(possible) == 0 {
+		return "died of unknown causes"
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(userID))
+
+	pick := rand.New(rand.NewSource(int64(hash.Sum64()))).Float64() * total
+
+	for _, fate := range possible {
+		pick -= fate.weight()
+
+		if pick < 0 {
+			return fate.Text
+		}
+	}
+
+	return possible[len(possible)-1].Text
+}
+
+// Fate is how the user met their end
+func (user *User) Fate() string {
+	return chooseFate(fates, user.ID, time.Now(), user.Age())
+}
+
+// capitalize is for putting a fate at the start of a sentence
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func containsInt(list []int, i int) bool {
+	for _, item := range list {
+		if item == i {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
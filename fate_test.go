@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestChooseFate(t *testing.T) {
+	day := 24 * time.Hour
+	summer := time.Date(2020, time.July, 4, 12, 0, 0, 0, time.UTC)
+
+	fates := []Fate{
+		{Text: "died of Dysentery"},
+		{Text: "died of Cholera", Weight: 2},
+		{Text: "drowned fording the river", MaxTenureDays: 90},
+		{Text: "froze in the Blue Mountains", Months: []int{12, 1, 2}},
+		{Text: "was spooked to death by a ghost", Dates: []string{"10-31"}},
+	}
+
+	counts := map[string]int{}
+
+	for i := 0; i < 1000; i++ {
+		id := string(rune('A'+i%26)) + string(rune('a'+i/26))
+		fate := chooseFate(fates, id, summer, 400*day)
+
+		if fate != chooseFate(fates, id, summer, 400*day) {
+			t.Fatalf("expected %s to meet the same fate every time", id)
+		}
+
+		counts[fate]++
+	}
+
+	for _, impossible := range []string{"drowned fording the river", "froze in the Blue Mountains", "was spooked to death by a ghost"} {
+		if counts[impossible] > 0 {
+			t.Errorf("expected nobody to have %s, got %d", impossible, counts[impossible])
+		}
+	}
+
+	if counts["died of Cholera"] <= counts["died of Dysentery"] {
+		t.Errorf("expected cholera to be more common than dysentery, got %v", counts)
+	}
+
+	halloween := time.Date(2020, time.October, 31, 12, 0, 0, 0, time.UTC)
+	only := []Fate{{Text: "was spooked to death by a ghost", Dates: []string{"10-31"}}}
+
+	if fate := chooseFate(only, "U1", halloween, day); fate != "was spooked to death by a ghost" {
+		t.Errorf("expected a spooky death on halloween, got %s", fate)
+	}
+
+	if fate := chooseFate(only, "U1", summer, day); fate != "died of unknown causes" {
+		t.Errorf("expected unknown causes with no possible fates, got %s", fate)
+	}
+}
+
+func TestFatePossible(t *testing.T) {
+	winter := time.Date(2021, time.January, 15, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		fate     Fate
+		tenure   time.Duration
+		expected bool
+	}{
+		{Fate{}, 0, true},
+		{Fate{MaxTenureDays: 90}, 89 * day, true},
+		{Fate{MaxTenureDays: 90}, 90 * day, false},
+		{Fate{MinTenureDays: 365}, 30 * day, false},
+		{Fate{Months: []int{12, 1, 2}}, day, true},
+		{Fate{Months: []int{6, 7, 8}}, day, false},
+		{Fate{Dates: []string{"01-15"}}, day, true},
+	}
+
+	for _, test := range tests {
+		if possible := test.fate.Possible(winter, test.tenure); possible != test.expected {
+			t.Errorf("expected %#v with tenure %s to be possible %t", test.fate, test.tenure, test.expected)
+		}
+	}
+}
+
+func TestLoadFates(t *testing.T) {
+	file, err := ioutil.TempFile("", "fates*.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(`{"fates": [{"text": "died of Dysentery", "weight": 2}, {"text": "was bitten by a snake", "months": [6, 7, 8]}]}`)
+	file.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadFates(file.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 2 || loaded[0].Weight != 2 || len(loaded[1].Months) != 3 {
+		t.Errorf("unexpected fates %#v", loaded)
+	}
+
+	for _, weight := range []string{"0", "-1"} {
+		if _, err := loadFates(`{"fates": [{"text": "died of Dysentery", "weight": ` + weight + `}]}`); err == nil {
+			t.Errorf("expected an error loading a fate with weight %s", weight)
+		}
+	}
+
+	if defaults, err := loadFates(""); err != nil || len(defaults) != len(defaultFates) {
+		t.Errorf("expected the default fates without a file, got %d, %v", len(defaults), err)
+	}
+}
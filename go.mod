@@ -4,6 +4,8 @@ require (
 	github.com/PuerkitoBio/goquery v1.5.1
 	github.com/aws/aws-lambda-go v1.8.1
 	github.com/getsentry/sentry-go v0.7.0
+	github.com/go-asn1-ber/asn1-ber v1.5.1
+	github.com/go-ldap/ldap/v3 v3.2.4
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/lib/pq v1.0.0
 	github.com/pkg/errors v0.8.1
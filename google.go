@@ -2,10 +2,23 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
-	"os"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
+// googleImages searches google's custom search engine for images. Searches are cached since the
+// free quota is only 100 a day.
+type googleImages struct {
+	URL   string
+	CX    string
+	Key   string
+	Cache imageCache
+}
+
 type searchResult struct {
 	Kind  string `json:"kind"`
 	Items []struct {
@@ -16,8 +29,42 @@ type searchResult struct {
 	} `json:"items"`
 }
 
-func findImages(query string) (*searchResult, error) {
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/customsearch/v1", nil)
+func (google googleImages) Image(theme string) (string, error) {
+	query := imageQueries[theme]
+
+	if query == "" {
+		return "", nil
+	}
+
+	urls, err := cachedImages(google.Cache, "google:"+query, imageCacheTTL, func() ([]string, error) {
+		result, err := google.findImages(query)
+
+		if err != nil {
+			return nil, err
+		}
+
+		urls := []string{}
+
+		for _, item := range result.Items {
+			urls = append(urls, item.Image.ThumbnailLink)
+		}
+
+		return urls, nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return pickImage(urls), nil
+}
+
+func (google googleImages) findImages(query string) (*searchResult, error) {
+	if google.CX == "" || google.Key == "" {
+		return nil, errors.New("google images need GOOGLE_SEARCH_CX and GOOGLE_SEARCH_KEY")
+	}
+
+	req, err := http.NewRequest("GET", google.URL, nil)
 
 	if err != nil {
 		return nil, err
@@ -26,19 +73,26 @@ func findImages(query string) (*searchResult, error) {
 	q := req.URL.Query()
 	q.Add("q", query)
 	q.Add("searchType", "image")
-	q.Add("cx", os.Getenv("GOOGLE_SEARCH_CX"))
-	q.Add("key", os.Getenv("GOOGLE_SEARCH_KEY"))
+	q.Add("cx", google.CX)
+	q.Add("key", google.Key)
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := (&http.Client{}).Do(req)
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
 
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "searching google images for %s", query)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("searching google images for %s, expected 200 status but got %d: %s", query, resp.StatusCode, message)
 	}
 
 	result := searchResult{}
 
 	err = json.NewDecoder(resp.Body).Decode(&result)
 
-	return &result, err
+	return &result, errors.Wrapf(err, "decoding google images for %s", query)
 }
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// EmployeeVersion is what an employee looked like between ValidFrom and ValidTo. The current
+// version has no ValidTo.
+type EmployeeVersion struct {
+	EmployeeID   string         `db:"employee_id"`
+	Name         string         `db:"name"`
+	SupervisorID sql.NullString `db:"supervisor_id"`
+	ReportsCount int            `db:"reports_count"`
+	Deleted      bool           `db:"deleted"`
+	ValidFrom    time.Time      `db:"valid_from"`
+	ValidTo      pq.NullTime    `db:"valid_to"`
+	Title        string         `db:"title"`
+	Department   string         `db:"department"`
+	Location     string         `db:"location"`
+}
+
+func versionOf(employee *Employee) *EmployeeVersion {
+	return &EmployeeVersion{
+		EmployeeID:   employee.ID,
+		Name:         employee.Name,
+		SupervisorID: sql.NullString{String: employee.SupervisorID, Valid: true},
+		ReportsCount: employee.ReportsCount,
+		Deleted:      employee.Deleted,
+		Title:        employee.Title,
+		Department:   employee.Department,
+		Location:     employee.Location,
+	}
+}
+
+func (version *EmployeeVersion) Same(other *EmployeeVersion) bool {
+	return version.Name == other.Name &&
+		version.SupervisorID.String == other.SupervisorID.String &&
+		version.ReportsCount == other.ReportsCount &&
+		version.Deleted == other.Deleted &&
+		version.Title == other.Title &&
+		version.Department == other.Department &&
+		version.Location == other.Location
+}
+
+func (version *EmployeeVersion) Employee() *Employee {
+	return &Employee{
+		ID:           version.EmployeeID,
+		Name:         version.Name,
+		SupervisorID: version.SupervisorID.String,
+		ReportsCount: version.ReportsCount,
+		Deleted:      version.Deleted,
+		Title:        version.Title,
+		Department:   version.Department,
+		Location:     version.Location,
+	}
+}
+
+// recordEmployeeVersion closes out the current version of an employee and starts a new one, unless
+// nothing we keep history for has changed
+func recordEmployeeVersion(employee *Employee, at time.Time) error {
+	current := EmployeeVersion{}
+
+	err := db.Get(&current, "SELECT * FROM employee_versions WHERE employee_id = $1 AND valid_to IS NULL", employee.ID)
+
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrapf(err, "finding current version of employee %s", employee.ID)
+	}
+
+	version := versionOf(employee)
+	version.ValidFrom = at
+
+	if err == nil {
+		if current.Same(version) {
+			return nil
+		}
+
+		_, err = db.Exec("UPDATE employee_versions SET valid_to = $1 WHERE employee_id = $2 AND valid_to IS NULL", at, employee.ID)
+
+		if err != nil {
+			return errors.Wrapf(err, "closing current version of employee %s", employee.ID)
+		}
+	}
+
+	_, err = db.NamedExec(`
+		INSERT INTO employee_versions
+		(employee_id, name, supervisor_id, reports_count, deleted, valid_from, title, department, location)
+		VALUES
+		(:employee_id, :name, :supervisor_id, :reports_count, :deleted, :valid_from, :title, :department, :location)
+		`, version)
+
+	return errors.Wrapf(err, "inserting employee version %#v", version)
+}
+
+// employeesAt is employeesFromDatabase as of some point in the past, only including employees who
+// were around at the time. Versions start at valid_from and end just before valid_to.
+func employeesAt(at time.Time) ([]*Employee, error) {
+	versions := []EmployeeVersion{}
+
+	err := db.Select(&versions, `
+		SELECT * FROM employee_versions
+		WHERE valid_from <= $1
+		AND (valid_to IS NULL OR valid_to > $1)
+		AND NOT deleted
+		`, at)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "selecting employees at %s", at)
+	}
+
+	employees := make([]*Employee, len(versions))
+
+	for i := range versions {
+		employees[i] = versions[i].Employee()
+	}
+
+	return employees, nil
+}
+
+// OrgChange is one difference between two org charts
+type OrgChange struct {
+	Kind   string
+	Before *Employee
+	After  *Employee
+}
+
+const (
+	OrgChangeJoined = "joined"
+	OrgChangeLeft   = "left"
+	OrgChangeMoved  = "moved"
+)
+
+// diffOrgCharts lists who joined, left, or changed supervisors between two sets of employees
+func diffOrgCharts(before, after []*Employee) []OrgChange {
+	beforeLookup := map[string]*Employee{}
+	afterLookup := map[string]*Employee{}
+
+	for _, employee := range before {
+		beforeLookup[employee.ID] = employee
+	}
+
+	for _, employee := range after {
+		afterLookup[employee.ID] = employee
+	}
+
+	changes := []OrgChange{}
+
+	for _, a := range after {
+		b, ok := beforeLookup[a.ID]
+
+		if !ok {
+			changes = append(changes, OrgChange{Kind: OrgChangeJoined, After: a})
+		} else if a.SupervisorID != b.SupervisorID {
+			changes = append(changes, OrgChange{Kind: OrgChangeMoved, Before: b, After: a})
+		}
+	}
+
+	for _, b := range before {
+		if _, ok := afterLookup[b.ID]; !ok {
+			changes = append(changes, OrgChange{Kind: OrgChangeLeft, Before: b})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Name() < changes[j].Name()
+	})
+
+	return changes
+}
+
+func (change OrgChange) Name() string {
+	if change.After != nil {
+		return change.After.Name
+	}
+	return change.Before.Name
+}
+
+func printOrgChanges(w io.Writer, changes []OrgChange, before, after []*Employee) {
+	names := map[string]string{}
+
+	for _, employees := range [][]*Employee{before, after} {
+		for _, employee := range employees {
+			names[employee.ID] = employee.Name
+		}
+	}
+
+	supervisor := func(employee *Employee) string {
+		if name, ok := names[employee.SupervisorID]; ok {
+			return name
+		}
+		return "nobody"
+	}
+
+	for _, change := range changes {
+		switch change.Kind {
+		case OrgChangeJoined:
+			fmt.Fprintf(w, "+ %s joined under %s\n", change.After.Name, supervisor(change.After))
+		case OrgChangeLeft:
+			fmt.Fprintf(w, "- %s left from under %s\n", change.Before.Name, supervisor(change.Before))
+		case OrgChangeMoved:
+			fmt.Fprintf(w, "~ %s moved from %s to %s\n", change.After.Name, supervisor(change.Before), supervisor(change.After))
+		}
+	}
+}
+
+// parseDate accepts a plain date, which means midnight local time, or a full timestamp
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+
+	return t, errors.Wrapf(err, "parsing date %s, expected YYYY-MM-DD or RFC3339", s)
+}
+
+func runOrgChartDiff(from, to string) error {
+	fromTime, err := parseDate(from)
+
+	if err != nil {
+		return err
+	}
+
+	toTime, err := parseDate(to)
+
+	if err != nil {
+		return err
+	}
+
+	before, err := employeesAt(fromTime)
+
+	if err != nil {
+		return err
+	}
+
+	after, err := employeesAt(toTime)
+
+	if err != nil {
+		return err
+	}
+
+	printOrgChanges(os.Stdout, diffOrgCharts(before, after), before, after)
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffOrgCharts(t *testing.T) {
+	before := []*Employee{
+		{ID: "E1", Name: "Jane Doe", SupervisorID: "E9"},
+		{ID: "E2", Name: "John Roe", SupervisorID: "E9"},
+		{ID: "E3", Name: "Alex Poe", SupervisorID: "E9"},
+	}
+
+	after := []*Employee{
+		{ID: "E1", Name: "Jane Doe", SupervisorID: "E9", Title: "Promoted"},
+		{ID: "E2", Name: "John Roe", SupervisorID: "E1"},
+		{ID: "E4", Name: "Bea Low", SupervisorID: "E1"},
+	}
+
+	found := []string{}
+
+	for _, change := range diffOrgCharts(before, after) {
+		found = append(found, change.Kind+" "+change.Name())
+	}
+
+	expected := []string{"left Alex Poe", "joined Bea Low", "moved John Roe"}
+
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected changes %q, got %q", expected, found)
+	}
+
+	if changes := diffOrgCharts(before, before); len(changes) != 0 {
+		t.Errorf("expected no changes between the same org charts, got %+v", changes)
+	}
+}
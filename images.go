@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+// ImageProvider finds an image to go with an announcement, an empty url means there isn't one
+type ImageProvider interface {
+	Image(theme string) (string, error)
+}
+
+// images is where announcements get their images, see the --images flag
+var images ImageProvider
+
+// Announcement themes, and what to search for to illustrate them
+const (
+	ImageBirth = "birth"
+	ImageDeath = "death"
+	ImageEmoji = "emoji"
+)
+
+var imageQueries = map[string]string{
+	ImageBirth: "oregon trail wagon",
+	ImageDeath: "oregon trail tombstone",
+	ImageEmoji: "oregon trail pixel art",
+}
+
+const imageCacheTTL = 7 * 24 * time.Hour
+
+func newImageProvider(kind, dir string) (ImageProvider, error) {
+	switch kind {
+	case "none", "":
+		return noImages{}, nil
+	case "google":
+		return googleImages{
+			URL:   "https://www.googleapis.com/customsearch/v1",
+			CX:    os.Getenv("GOOGLE_SEARCH_CX"),
+			Key:   os.Getenv("GOOGLE_SEARCH_KEY"),
+			Cache: dbImageCache{},
+		}, nil
+	case "dir":
+		if dir == "" {
+			return nil, errors.New("the dir image provider needs --images-dir")
+		}
+		return dirImages{Path: dir, Cache: dbImageCache{}, Upload: uploadImage}, nil
+	default:
+		return nil, fmt.Errorf("unsupported image provider %s", kind)
+	}
+}
+
+// themedAttachments illustrates an announcement if there's an image for it. Announcements are more
+// important than their pictures, so failing to find one is only logged.
+func themedAttachments(theme string) []slack.Attachment {
+	if images == nil {
+		return nil
+	}
+
+	url, err := images.Image(theme)
+
+	if err != nil {
+		log.Printf("Couldn't find a %s image: %s\n", theme, err)
+		return nil
+	}
+
+	if url == "" {
+		return nil
+	}
+
+	return []slack.Attachment{{ImageURL: url}}
+}
+
+func pickImage(urls []string) string {
+	if len(urls) == 0 {
+		return ""
+	}
+	return urls[rand.Intn(len(urls))]
+}
+
+type noImages struct{}
+
+func (noImages) Image(theme string) (string, error) {
+	return "", nil
+}
+
+// dirImages picks from a directory of curated images with a subdirectory for each theme, e.g.
+// death/tombstone.png. Slack needs urls, so each image is uploaded the first time it's used.
+type dirImages struct {
+	Path   string
+	Cache  imageCache
+	Upload func(r io.Reader, filename, title string) (string, error)
+}
+
+func (dir dirImages) Image(theme string) (string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(dir.Path, theme))
+
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", errors.Wrapf(err, "listing %s images", theme)
+	}
+
+	paths := []string{}
+
+	for _, file := range files {
+		switch strings.ToLower(filepath.Ext(file.Name())) {
+		case ".png", ".jpg", ".jpeg", ".gif":
+			paths = append(paths, filepath.Join(dir.Path, theme, file.Name()))
+		}
+	}
+
+	path := pickImage(paths)
+
+	if path == "" {
+		return "", nil
+	}
+
+	// Uploads don't expire, so they're cached forever
+	urls, err := cachedImages(dir.Cache, "dir:"+path, 0, func() ([]string, error) {
+		file, err := os.Open(path)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "opening image %s", path)
+		}
+
+		defer file.Close()
+
+		url, err := dir.Upload(file, filepath.Base(path), theme)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{url}, nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return pickImage(urls), nil
+}
+
+// imageCache remembers image urls by key, a maxAge of 0 means entries never expire
+type imageCache interface {
+	Get(key string, maxAge time.Duration) ([]string, bool, error)
+	Put(key string, urls []string) error
+}
+
+func cachedImages(cache imageCache, key string, maxAge time.Duration, fetch func() ([]string, error)) ([]string, error) {
+	if cache == nil {
+		return fetch()
+	}
+
+	urls, ok, err := cache.Get(key, maxAge)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		return urls, nil
+	}
+
+	urls, err = fetch()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = cache.Put(key, urls)
+
+	return urls, err
+}
+
+type dbImageCache struct{}
+
+func (dbImageCache) Get(key string, maxAge time.Duration) ([]string, bool, error) {
+	entry := struct {
+		URLs     pq.StringArray `db:"urls"`
+		CachedAt time.Time      `db:"cached_at"`
+	}{}
+
+	err := db.Get(&entry, "SELECT urls, cached_at FROM image_cache WHERE key = $1", key)
+
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "getting cached images for %s", key)
+	}
+
+	if maxAge > 0 && time.Since(entry.CachedAt) > maxAge {
+		return nil, false, nil
+	}
+
+	return entry.URLs, true, nil
+}
+
+func (dbImageCache) Put(key string, urls []string) error {
+	_, err := db.Exec(`
+		INSERT INTO image_cache
+		(key, urls, cached_at)
+		VALUES
+		($1, $2, now())
+		ON CONFLICT (key) DO UPDATE SET urls = excluded.urls, cached_at = excluded.cached_at
+	`, key, pq.StringArray(urls))
+
+	return errors.Wrapf(err, "caching images for %s", key)
+}
+
+// uploadImage puts an image in slack and returns a url attachments can show it with
+func uploadImage(r io.Reader, filename, title string) (string, error) {
+	file, err := slackClient.UploadFile(slack.FileUploadParameters{
+		Reader:   r,
+		Filename: filename,
+		Title:    title,
+	})
+
+	if err != nil {
+		return "", errors.Wrapf(err, "uploading %s", filename)
+	}
+
+	// Files are private until shared, and attachments can only show public images
+	file, _, _, err = slackClient.ShareFilePublicURL(file.ID)
+
+	if err != nil {
+		return "", errors.Wrapf(err, "sharing %s", filename)
+	}
+
+	return publicFileURL(file)
+}
+
+// publicFileURL is the direct link to a publicly shared file, the public permalink is a page that
+// ends with the secret the private url needs
+func publicFileURL(file *slack.File) (string, error) {
+	i := strings.LastIndex(file.PermalinkPublic, "-")
+
+	if i < 0 || file.URLPrivate == "" {
+		return "", fmt.Errorf("file %s has no public url", file.ID)
+	}
+
+	return fmt.Sprintf("%s?pub_secret=%s", file.URLPrivate, file.PermalinkPublic[i+1:]), nil
+}
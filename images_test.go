@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+type memoryImageCache map[string][]string
+
+func (cache memoryImageCache) Get(key string, maxAge time.Duration) ([]string, bool, error) {
+	urls, ok := cache[key]
+	return urls, ok, nil
+}
+
+func (cache memoryImageCache) Put(key string, urls []string) error {
+	cache[key] = urls
+	return nil
+}
+
+func fakeGoogle(t *testing.T, status int, searches *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*searches++
+
+		q := r.URL.Query()
+
+		if q.Get("q") != imageQueries[ImageDeath] || q.Get("searchType") != "image" || q.Get("cx") != "cx" || q.Get("key") != "key" {
+			t.Errorf("unexpected search %s", r.URL.RawQuery)
+		}
+
+		if status != 200 {
+			http.Error(w, "quota exceeded", status)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"kind": "customsearch#search",
+			"items": []interface{}{
+				map[string]interface{}{"image": map[string]string{"thumbnailLink": "https://example.com/grave.png"}},
+			},
+		})
+	}))
+}
+
+func TestGoogleImages(t *testing.T) {
+	searches := 0
+	server := fakeGoogle(t, 200, &searches)
+	defer server.Close()
+
+	google := googleImages{URL: server.URL, CX: "cx", Key: "key", Cache: memoryImageCache{}}
+
+	for i := 0; i < 2; i++ {
+		url, err := google.Image(ImageDeath)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if url != "https://example.com/grave.png" {
+			t.Errorf("expected the search result, got %s", url)
+		}
+	}
+
+	if searches != 1 {
+		t.Errorf("expected the second image to come from the cache, searched %d times", searches)
+	}
+
+	if url, err := google.Image("unthemed"); url != "" || err != nil {
+		t.Errorf("expected no image for an unknown theme, got %s, %v", url, err)
+	}
+}
+
+func TestGoogleImagesError(t *testing.T) {
+	searches := 0
+	server := fakeGoogle(t, 403, &searches)
+	defer server.Close()
+
+	cache := memoryImageCache{}
+	google := googleImages{URL: server.URL, CX: "cx", Key: "key", Cache: cache}
+
+	if _, err := google.Image(ImageDeath); err == nil {
+		t.Errorf("expected an error for a 403")
+	}
+
+	if len(cache) != 0 {
+		t.Errorf("expected failed searches not to be cached, got %v", cache)
+	}
+}
+
+func TestDirImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trail-images")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, ImageBirth), 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"wagon.png", "README.md"} {
+		err = ioutil.WriteFile(filepath.Join(dir, ImageBirth, name), []byte(name), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uploads := []string{}
+
+	images := dirImages{
+		Path:  dir,
+		Cache: memoryImageCache{},
+		Upload: func(r io.Reader, filename, title string) (string, error) {
+			body, _ := ioutil.ReadAll(r)
+			uploads = append(uploads, string(body))
+			return "https://files.slack.com/" + filename, nil
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		url, err := images.Image(ImageBirth)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if url != "https://files.slack.com/wagon.png" {
+			t.Errorf("expected the uploaded wagon, got %s", url)
+		}
+	}
+
+	if len(uploads) != 1 || uploads[0] != "wagon.png" {
+		t.Errorf("expected the wagon to be uploaded once, got %v", uploads)
+	}
+
+	if url, err := images.Image(ImageDeath); url != "" || err != nil {
+		t.Errorf("expected no image for a theme without a directory, got %s, %v", url, err)
+	}
+}
+
+func TestPublicFileURL(t *testing.T) {
+	file := &slack.File{
+		ID:              "F123",
+		URLPrivate:      "https://files.slack.com/files-pri/T1-F123/tombstone-u1.png",
+		PermalinkPublic: "https://slack-files.com/T1-F123-abc123",
+	}
+
+	url, err := publicFileURL(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "https://files.slack.com/files-pri/T1-F123/tombstone-u1.png?pub_secret=abc123"; url != expected {
+		t.Errorf("expected %s, got %s", expected, url)
+	}
+
+	if _, err := publicFileURL(&slack.File{ID: "F1"}); err == nil {
+		t.Errorf("expected an error for an unshared file")
+	}
+}
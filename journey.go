@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Landmark is a stop on the trail, Miles from Independence
+type Landmark struct {
+	Name  string
+	Miles int
+}
+
+var landmarks = []Landmark{
+	{"Independence, Missouri", 0},
+	{"the Kansas River crossing", 102},
+	{"the Big Blue River crossing", 185},
+	{"Fort Kearney", 304},
+	{"Chimney Rock", 554},
+	{"Fort Laramie", 640},
+	{"Independence Rock", 830},
+	{"South Pass", 932},
+	{"the Green River crossing", 989},
+	{"Soda Springs", 1151},
+	{"Fort Hall", 1208},
+	{"the Snake River crossing", 1390},
+	{"Fort Boise", 1504},
+	{"the Blue Mountains", 1664},
+	{"The Dalles", 1824},
+	{"the Willamette Valley", 2040},
+}
+
+var trailMiles = landmarks[len(landmarks)-1].Miles
+
+// journeyYears is how long it takes to reach the Willamette Valley, see the --journey-years flag
+var journeyYears = 5.0
+
+// Incidents are the events worth plotting on someone's journey
+var incidentKinds = map[string]bool{
+	EventRename:     true,
+	EventUserTitle:  true,
+	EventNecromance: true,
+	EventSupervisor: true,
+	EventTitle:      true,
+	EventDepartment: true,
+	EventLocation:   true,
+}
+
+func milesPerDay() float64 {
+	return float64(trailMiles) / (journeyYears * 365)
+}
+
+// milesTraveled is how far along the trail someone is after some time in slack
+func milesTraveled(tenure time.Duration) int {
+	miles := int(tenure.Hours() / 24 * milesPerDay())
+
+	if miles < 0 {
+		return 0
+	}
+
+	if miles > trailMiles {
+		return trailMiles
+	}
+
+	return miles
+}
+
+// arrival is the day someone who started the trail at start reaches a landmark
+func arrival(start time.Time, landmark Landmark) time.Time {
+	return start.AddDate(0, 0, int(math.Ceil(float64(landmark.Miles)/milesPerDay())))
+}
+
+// landmarkAt is the last landmark passed after traveling some miles
+func landmarkAt(miles int) int {
+	index := 0
+
+	for i, landmark := range landmarks {
+		if landmark.Miles <= miles {
+			index = i
+		}
+	}
+
+	return index
+}
+
+// landmarkGrace is how long after arriving at a landmark it's still celebrated, so that a missed
+// run doesn't lose it, without celebrating every landmark anyone ever passed the first time
+const landmarkGrace = 7 * 24 * time.Hour
+
+// landmarkReached is the furthest landmark someone has arrived at, if they arrived recently.
+// Independence doesn't count, everyone starts there. A landmark is reached on every day of the
+// grace period, celebrate takes care of only announcing it once.
+func landmarkReached(start, today time.Time) (int, bool) {
+	index := landmarkAt(milesTraveled(today.Sub(start)))
+
+	if index == 0 {
+		return 0, false
+	}
+
+	arrived := arrival(start, landmarks[index]).In(today.Location())
+	arrivedOn := time.Date(arrived.Year(), arrived.Month(), arrived.Day(), 0, 0, 0, 0, today.Location())
+
+	if today.Before(arrivedOn) || today.Sub(arrivedOn) >= landmarkGrace {
+		return 0, false
+	}
+
+	return index, true
+}
+
+func landmarkText(user *User, index int) string {
+	if index == len(landmarks)-1 {
+		return fmt.Sprintf("%s made it to %s, the end of the trail!", user.Describe(), landmarks[index].Name)
+	}
+
+	return fmt.Sprintf("%s reached %s, %d miles down the trail", user.Describe(), landmarks[index].Name, landmarks[index].Miles)
+}
+
+func landmarkEmoji(index int) string {
+	if index == len(landmarks)-1 {
+		return ":checkered_flag:"
+	}
+	return ":world_map:"
+}
+
+type journeyEntry struct {
+	At       time.Time
+	Landmark *Landmark
+	Event    *Event
+}
+
+// journeyEntries puts landmarks and incidents along the way in order
+func journeyEntries(start time.Time, events []Event) []journeyEntry {
+	entries := []journeyEntry{}
+
+	for i := range landmarks {
+		entries = append(entries, journeyEntry{At: arrival(start, landmarks[i]), Landmark: &landmarks[i]})
+	}
+
+	for i := range events {
+		if incidentKinds[events[i].Kind] {
+			entries = append(entries, journeyEntry{At: events[i].CreatedAt, Event: &events[i]})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+
+	return entries
+}
+
+func printJourney(w io.Writer, user *User, events []Event, now time.Time) {
+	end := now
+	if user.DeletedAt.Valid {
+		end = user.DeletedAt.Time
+	}
+
+	miles := milesTraveled(end.Sub(user.CreatedAt))
+	near := landmarks[landmarkAt(miles)].Name
+
+	if user.Deleted {
+		fmt.Fprintf(w, "%s died near %s, %d miles down the trail\n\n", user.SomeName(), near, miles)
+	} else {
+		fmt.Fprintf(w, "%s has traveled %d of %d miles and is near %s\n\n", user.SomeName(), miles, trailMiles, near)
+	}
+
+	for _, entry := range journeyEntries(user.CreatedAt, events) {
+		date := entry.At.Format("2006-01-02")
+
+		switch {
+		case entry.Event != nil:
+			fmt.Fprintf(w, "  ! %s  %s\n", date, entry.Event.Text)
+		case !entry.At.After(end):
+			fmt.Fprintf(w, "  * %s  %s (mile %d)\n", date, entry.Landmark.Name, entry.Landmark.Miles)
+		case !user.Deleted:
+			fmt.Fprintf(w, "    %s  %s (in %d days)\n", date, entry.Landmark.Name, int(math.Ceil(entry.At.Sub(now).Hours()/24)))
+		}
+	}
+}
+
+func runJourney(userRef string) error {
+	user, err := findUser(userRef)
+
+	if err != nil {
+		return err
+	}
+
+	employee, err := employeeForUser(user)
+
+	if err != nil {
+		return err
+	}
+
+	events, err := eventsFor(user, employee)
+
+	if err != nil {
+		return err
+	}
+
+	printJourney(os.Stdout, user, events, time.Now())
+
+	return nil
+}
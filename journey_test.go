@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMilesTraveled(t *testing.T) {
+	year := 365 * 24 * time.Hour
+
+	tests := map[time.Duration]int{
+		-year:     0,
+		0:         0,
+		year:      trailMiles / 5,
+		10 * year: trailMiles,
+	}
+
+	for tenure, expected := range tests {
+		if miles := milesTraveled(tenure); miles != expected {
+			t.Errorf("after %s expected %d miles, got %d", tenure, expected, miles)
+		}
+	}
+}
+
+func TestLandmarkReached(t *testing.T) {
+	start := time.Date(2019, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+	for i := 1; i < len(landmarks); i++ {
+		at := arrival(start, landmarks[i])
+
+		if index, ok := landmarkReached(start, at); !ok || index != i {
+			t.Errorf("expected to reach %s on %s, got %d, %t", landmarks[i].Name, at, index, ok)
+		}
+
+		if index := landmarkAt(milesTraveled(at.Sub(start))); index != i {
+			t.Errorf("expected to be at %s on %s, got %s", landmarks[i].Name, at, landmarks[index].Name)
+		}
+
+		if index, ok := landmarkReached(start, at.AddDate(0, 0, -1)); ok && index == i {
+			t.Errorf("expected not to reach %s a day early", landmarks[i].Name)
+		}
+
+		// A missed run still gets to celebrate, unless the next landmark has been reached since
+		if index, ok := landmarkReached(start, at.AddDate(0, 0, 3)); !ok || index < i {
+			t.Errorf("expected to still be at %s 3 days later, got %d, %t", landmarks[i].Name, index, ok)
+		}
+
+		if index, ok := landmarkReached(start, at.Add(landmarkGrace).AddDate(0, 0, 1)); ok && index == i {
+			t.Errorf("expected %s to be old news after a week", landmarks[i].Name)
+		}
+	}
+
+	if _, ok := landmarkReached(start, start); ok {
+		t.Errorf("expected leaving Independence not to count")
+	}
+}
+
+func TestPrintJourney(t *testing.T) {
+	start := time.Date(2019, time.January, 1, 9, 0, 0, 0, time.UTC)
+	now := start.AddDate(1, 0, 0)
+
+	user := &User{ID: "U1", Name: "zach", CreatedAt: start}
+
+	events := []Event{
+		{Kind: EventRename, Text: "zach changed their handle from zach to zt", CreatedAt: start.AddDate(0, 2, 0)},
+		{Kind: EventStatus, Text: "zach changed their status", CreatedAt: start.AddDate(0, 3, 0)},
+		{Kind: EventSupervisor, EmployeeID: sql.NullString{String: "1", Valid: true}, Text: "Zach's supervisor changed from Ann to Bob", CreatedAt: start.AddDate(0, 4, 0)},
+	}
+
+	out := bytes.Buffer{}
+	printJourney(&out, user, events, now)
+
+	journey := out.String()
+
+	for _, expected := range []string{
+		"has traveled 408 of 2040 miles and is near Fort Kearney",
+		"* 2019-01-01  Independence, Missouri (mile 0)",
+		"! 2019-03-01  zach changed their handle",
+		"! 2019-05-01  Zach's supervisor changed",
+		"Chimney Rock (in ",
+	} {
+		if !strings.Contains(journey, expected) {
+			t.Errorf("expected the journey to include %q, got\n%s", expected, journey)
+		}
+	}
+
+	if strings.Contains(journey, "status") {
+		t.Errorf("expected status changes not to be incidents, got\n%s", journey)
+	}
+
+	if strings.Index(journey, "handle") > strings.Index(journey, "Fort Kearney (mile") {
+		t.Errorf("expected incidents in order with landmarks, got\n%s", journey)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+// Where the jsonl messenger writes, and when it rotates, see the jsonl flags
+var (
+	jsonlFile     = ""
+	jsonlMaxSize  = 100 // megabytes
+	jsonlMaxFiles = 5
+)
+
+// jsonlRecord is a line the jsonl messenger writes. Messages that aren't about an event, like
+// trail reports, have the kind "message".
+type jsonlRecord struct {
+	Kind        string             `json:"kind"`
+	OccurredAt  time.Time          `json:"occurred_at"`
+	SentAt      time.Time          `json:"sent_at"`
+	UserID      string             `json:"user_id,omitempty"`
+	EmployeeID  string             `json:"employee_id,omitempty"`
+	Old         string             `json:"old,omitempty"`
+	New         string             `json:"new,omitempty"`
+	Text        string             `json:"text"`
+	Emoji       string             `json:"emoji,omitempty"`
+	Channel     string             `json:"channel,omitempty"`
+	Attachments []slack.Attachment `json:"attachments,omitempty"`
+}
+
+func newJSONLRecord(message Message, now time.Time) jsonlRecord {
+	record := jsonlRecord{
+		Kind:        "message",
+		OccurredAt:  now,
+		SentAt:      now,
+		Text:        message.Text,
+		Emoji:       message.Emoji,
+		Channel:     message.Channel,
+		Attachments: message.Attachments,
+	}
+
+	event := message.Event
+
+	if event == nil {
+		return record
+	}
+
+	record.Kind = event.Kind
+	record.UserID = event.UserID.String
+	record.EmployeeID = event.EmployeeID.String
+	record.Old = event.Old
+	record.New = event.New
+
+	if !event.CreatedAt.IsZero() {
+		record.OccurredAt = event.CreatedAt
+	}
+
+	return record
+}
+
+// jsonlWriter writes a line for each message, to stdout or to a file that's rotated when it gets
+// too big, like trail.jsonl to trail.jsonl.1 to trail.jsonl.2
+type jsonlWriter struct {
+	Path     string
+	MaxSize  int64 // bytes, 0 never rotates
+	MaxFiles int   // rotated files to keep
+
+	mu   sync.Mutex
+	out  io.Writer
+	file *os.File
+	size int64
+}
+
+func newJSONLMessenger(path string, maxSize int64, maxFiles int) messageFunc {
+	writer := &jsonlWriter{Path: path, MaxSize: maxSize, MaxFiles: maxFiles}
+
+	if path == "" {
+		writer.out = os.Stdout
+	}
+
+	return writer.Send
+}
+
+func (writer *jsonlWriter) Send(message Message) error {
+	line, err := json.Marshal(newJSONLRecord(message, time.Now()))
+
+	if err != nil {
+		return errors.Wrap(err, "encoding jsonl record")
+	}
+
+	return writer.Write(append(line, '\n'))
+}
+
+func (writer *jsonlWriter) Write(line []byte) error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.Path == "" {
+		_, err := writer.out.Write(line)
+		return errors.Wrap(err, "writing jsonl")
+	}
+
+	if writer.file != nil && writer.MaxSize > 0 && writer.size > 0 && writer.size+int64(len(line)) > writer.MaxSize {
+		err := writer.rotate()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if writer.file == nil {
+		err := writer.open()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := writer.file.Write(line)
+	writer.size += int64(n)
+
+	return errors.Wrapf(err, "writing %s", writer.Path)
+}
+
+func (writer *jsonlWriter) open() error {
+	file, err := os.OpenFile(writer.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", writer.Path)
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "checking the size of %s", writer.Path)
+	}
+
+	writer.file = file
+	writer.size = info.Size()
+
+	// A file that's already too big from a previous run is rotated before it's written to
+	if writer.MaxSize > 0 && writer.size >= writer.MaxSize {
+		return writer.rotate()
+	}
+
+	return nil
+}
+
+func (writer *jsonlWriter) rotate() error {
+	err := writer.file.Close()
+	writer.file = nil
+
+	if err != nil {
+		return errors.Wrapf(err, "closing %s", writer.Path)
+	}
+
+	if writer.MaxFiles <= 0 {
+		return errors.Wrapf(os.Remove(writer.Path), "removing %s", writer.Path)
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", writer.Path, writer.MaxFiles))
+
+	for i := writer.MaxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", writer.Path, i), fmt.Sprintf("%s.%d", writer.Path, i+1))
+
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "rotating %s", writer.Path)
+		}
+	}
+
+	err = os.Rename(writer.Path, writer.Path+".1")
+
+	if err != nil {
+		return errors.Wrapf(err, "rotating %s", writer.Path)
+	}
+
+	return writer.open()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLRecord(t *testing.T) {
+	message := deathMessage()
+	message.Event.Changed("", "died of Dysentery")
+	message.Event.CreatedAt = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := message.Event.CreatedAt.Add(time.Minute)
+
+	line, err := json.Marshal(newJSONLRecord(message, now))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := map[string]interface{}{}
+
+	if err := json.Unmarshal(line, &record); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"kind":        EventDeath,
+		"occurred_at": "2026-06-01T12:00:00Z",
+		"sent_at":     "2026-06-01T12:01:00Z",
+		"user_id":     "U1",
+		"new":         "died of Dysentery",
+		"text":        "Zach Taylor died of Dysentery",
+	}
+
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, record[key])
+		}
+	}
+
+	if _, ok := record["employee_id"]; ok {
+		t.Errorf("expected no employee id, got %s", line)
+	}
+
+	if attachments, ok := record["attachments"].([]interface{}); !ok || len(attachments) != 2 {
+		t.Errorf("expected the attachments, got %s", line)
+	}
+
+	if newJSONLRecord(Message{Text: "Trail Report"}, now).Kind != "message" {
+		t.Error("expected a message that isn't an event to be a plain message")
+	}
+}
+
+func TestJSONLRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trail-jsonl")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "trail.jsonl")
+	line := `{"kind":"message"}` + "\n"
+	writer := &jsonlWriter{Path: path, MaxSize: int64(len(line) * 2), MaxFiles: 2}
+
+	for i := 0; i < 7; i++ {
+		if err := writer.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writer.file.Close()
+
+	for name, lines := range map[string]int{"trail.jsonl": 1, "trail.jsonl.1": 2, "trail.jsonl.2": 2} {
+		if count := countLines(t, filepath.Join(dir, name)); count != lines {
+			t.Errorf("expected %d lines in %s, got %d", lines, name, count)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 rotated files to be kept")
+	}
+
+	// Picking up where a previous run left off
+	writer = &jsonlWriter{Path: path, MaxSize: int64(len(line) * 2), MaxFiles: 2}
+
+	if err := writer.Write([]byte(line)); err != nil {
+		t.Fatal(err)
+	}
+
+	writer.file.Close()
+
+	if count := countLines(t, path); count != 2 {
+		t.Errorf("expected to append to the existing file, got %d lines", count)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	file, err := os.Open(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "{") {
+			t.Errorf("expected json in %s, got %s", path, scanner.Text())
+		}
+		count++
+	}
+
+	return count
+}
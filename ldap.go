@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+// ldapDirectory gets employees from Active Directory or OpenLDAP, mapping entries the same way as
+// the LDIF directory
+type ldapDirectory struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	Filter       string
+	PageSize     uint32
+}
+
+var ldapAttributes = []string{
+	"employeeID",
+	"uid",
+	"cn",
+	"displayName",
+	"mail",
+	"manager",
+	"title",
+	"department",
+	"l",
+}
+
+// defaultLDAPFilter finds enabled Active Directory user accounts, leaving out computers which are
+// people too as far as objectClass goes. Other directories don't have objectCategory, so they need
+// LDAP_FILTER.
+const defaultLDAPFilter = "(&(objectCategory=person)(objectClass=user)(!(userAccountControl:1.2.840.113556.1.4.803:=2)))"
+
+func (directory ldapDirectory) Employees() ([]*Employee, error) {
+	if directory.URL == "" || directory.BaseDN == "" {
+		return nil, errors.New("the ldap directory needs LDAP_URL and LDAP_BASE_DN")
+	}
+
+	filter := directory.Filter
+	if filter == "" {
+		filter = defaultLDAPFilter
+	}
+
+	pageSize := directory.PageSize
+	if pageSize == 0 {
+		pageSize = 500
+	}
+
+	conn, err := ldap.DialURL(directory.URL)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "connecting to %s", directory.URL)
+	}
+
+	defer conn.Close()
+
+	conn.SetTimeout(30 * time.Second)
+
+	if directory.BindDN != "" {
+		err = conn.Bind(directory.BindDN, directory.BindPassword)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "binding as %s", directory.BindDN)
+		}
+	}
+
+	request := ldap.NewSearchRequest(
+		directory.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		filter,
+		ldapAttributes,
+		nil,
+	)
+
+	// NOTE: Directories cap how many entries one search returns (1000 for AD by default), so big orgs
+	// need paging
+	result, err := conn.SearchWithPaging(request, pageSize)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "searching %s for %s", directory.BaseDN, filter)
+	}
+
+	entries := []directoryEntry{}
+
+	for _, e := range result.Entries {
+		entry := directoryEntry{DN: e.DN, Attributes: map[string][]string{}}
+
+		for _, attribute := range e.Attributes {
+			entry.Attributes[strings.ToLower(attribute.Name)] = attribute.Values
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return employeesFromEntries(entries), nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeLDAP is an in process LDAP server that accepts any bind and answers every search with all of
+// its entries, a page at a time. It returns how many searches it has answered so far, and a func to
+// shut it down.
+func fakeLDAP(t *testing.T, entries []directoryEntry) (string, func() int, func()) {
+	var mu sync.Mutex
+	searches := 0
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Error listening %v", err)
+	}
+
+	respond := func(conn net.Conn, id int64, op *ber.Packet, controls ...ldap.Control) {
+		envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+		envelope.AppendChild(op)
+
+		if len(controls) > 0 {
+			packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+			for _, control := range controls {
+				packet.AppendChild(control.Encode())
+			}
+			envelope.AppendChild(packet)
+		}
+
+		conn.Write(envelope.Bytes())
+	}
+
+	result := func(tag ber.Tag) *ber.Packet {
+		op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+		op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, 0, "Result Code"))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+		return op
+	}
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+
+		for {
+			packet, err := ber.ReadPacket(conn)
+
+			if err != nil {
+				return
+			}
+
+			id := packet.Children[0].Value.(int64)
+
+			switch packet.Children[1].Tag {
+			case ldap.ApplicationBindRequest:
+				respond(conn, id, result(ldap.ApplicationBindResponse))
+			case ldap.ApplicationSearchRequest:
+				mu.Lock()
+				searches++
+				mu.Unlock()
+
+				size, offset := len(entries), 0
+
+				if len(packet.Children) > 2 {
+					for _, child := range packet.Children[2].Children {
+						control, err := ldap.DecodeControl(child)
+
+						if err != nil {
+							// NOTE: Only the test goroutine can t.Fatal
+							t.Errorf("Error decoding control %v", err)
+							return
+						}
+
+						if paging, ok := control.(*ldap.ControlPaging); ok {
+							size = int(paging.PagingSize)
+							offset, _ = strconv.Atoi(string(paging.Cookie))
+						}
+					}
+				}
+
+				end := offset + size
+				if end > len(entries) {
+					end = len(entries)
+				}
+
+				for _, entry := range entries[offset:end] {
+					op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+					op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+
+					attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+					for name, values := range entry.Attributes {
+						attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+						attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Name"))
+
+						set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+						for _, value := range values {
+							set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+						}
+
+						attribute.AppendChild(set)
+						attributes.AppendChild(attribute)
+					}
+
+					op.AppendChild(attributes)
+					respond(conn, id, op)
+				}
+
+				paging := ldap.NewControlPaging(uint32(size))
+				if end < len(entries) {
+					paging.SetCookie([]byte(strconv.Itoa(end)))
+				}
+
+				respond(conn, id, result(ldap.ApplicationSearchResultDone), paging)
+			default:
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go serve(conn)
+		}
+	}()
+
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return searches
+	}
+
+	return "ldap://" + listener.Addr().String(), count, func() { listener.Close() }
+}
+
+func TestLDAPDirectory(t *testing.T) {
+	url, searches, stop := fakeLDAP(t, []directoryEntry{
+		{DN: "cn=Adam Boss,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"cn": {"Adam Boss"}, "employeeID": {"1"}, "title": {"CEO"},
+		}},
+		{DN: "cn=Jane Doe,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"cn": {"Jane Doe"}, "employeeID": {"2"}, "mail": {"jane@example.com"},
+			"manager": {"CN=Adam Boss,OU=people,DC=example,DC=com"}, "department": {"Engineering"},
+		}},
+		{DN: "cn=John Smith,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"cn": {"John Smith"}, "employeeID": {"3"}, "manager": {"cn=Jane Doe,ou=people,dc=example,dc=com"},
+		}},
+	})
+	defer stop()
+
+	employees, err := ldapDirectory{
+		URL:          url,
+		BindDN:       "cn=trail,dc=example,dc=com",
+		BindPassword: "secret",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		PageSize:     2,
+	}.Employees()
+
+	if err != nil {
+		t.Fatalf("Error getting employees %v", err)
+	}
+
+	if count := searches(); count != 2 {
+		t.Errorf("Expected 2 pages of results, got %d", count)
+	}
+
+	expected := []Employee{
+		{ID: "1", Name: "Adam Boss", Title: "CEO", ReportsCount: 1},
+		{ID: "2", Name: "Jane Doe", SupervisorID: "1", Email: "jane@example.com", Department: "Engineering", ReportsCount: 1},
+		{ID: "3", Name: "John Smith", SupervisorID: "2"},
+	}
+
+	actual := []Employee{}
+	for _, employee := range employees {
+		actual = append(actual, *employee)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, actual)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ldifDirectory reads employees from an LDIF export of a directory, only enabled entries with a
+// person object class count
+type ldifDirectory struct {
+	Path string
+}
+
+func (directory ldifDirectory) Employees() ([]*Employee, error) {
+	file, err := os.Open(directory.Path)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "opening ldif directory")
+	}
+
+	defer file.Close()
+
+	entries, err := parseLDIF(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	people := []directoryEntry{}
+
+	for _, entry := range entries {
+		if isPerson(entry) {
+			people = append(people, entry)
+		}
+	}
+
+	return employeesFromEntries(people), nil
+}
+
+// isPerson is whether an entry is someone with an account. Active Directory computers are users
+// too, and disabled accounts have the ACCOUNTDISABLE bit of userAccountControl set.
+func isPerson(entry directoryEntry) bool {
+	person := false
+
+	for _, class := range entry.Attributes["objectclass"] {
+		switch strings.ToLower(class) {
+		case "person", "inetorgperson", "organizationalperson", "user":
+			person = true
+		case "computer":
+			return false
+		}
+	}
+
+	if control, err := strconv.Atoi(entry.Get("userAccountControl")); err == nil && control&2 != 0 {
+		return false
+	}
+
+	return person
+}
+
+// parseLDIF understands enough LDIF for directory exports: comments, folded lines and base64
+// values. Change records aren't supported.
+func parseLDIF(r io.Reader) ([]directoryEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	entries := []directoryEntry{}
+	lines := []string{}
+
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+
+		entry := directoryEntry{Attributes: map[string][]string{}}
+
+		for _, line := range lines {
+			attribute, value, err := parseLDIFLine(line)
+
+			if err != nil {
+				return err
+			}
+
+			if attribute == "dn" {
+				entry.DN = value
+			} else if attribute != "version" {
+				entry.Attributes[attribute] = append(entry.Attributes[attribute], value)
+			}
+		}
+
+		if entry.DN != "" {
+			entries = append(entries, entry)
+		}
+
+		lines = lines[:0]
+
+		return nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, " "):
+			if len(lines) == 0 {
+				return nil, fmt.Errorf("ldif continuation line without anything to continue: %q", line)
+			}
+
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading ldif")
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func parseLDIFLine(line string) (string, string, error) {
+	parts := strings.SplitN(line, ":", 2)
+
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("ldif line without an attribute: %q", line)
+	}
+
+	attribute := strings.ToLower(parts[0])
+	value := parts[1]
+
+	if strings.HasPrefix(value, ":") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+
+		if err != nil {
+			return "", "", errors.Wrapf(err, "decoding base64 ldif value of %s", attribute)
+		}
+
+		return attribute, string(decoded), nil
+	}
+
+	return attribute, strings.TrimSpace(value), nil
+}
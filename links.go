@@ -0,0 +1,411 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Where a link between a slack user and an employee came from. Manual links always win over the
+// heuristics.
+const (
+	LinkSourceManual = "manual"
+	LinkSourceEmail  = "email"
+	LinkSourceName   = "name"
+)
+
+type Link struct {
+	UserID     string    `db:"user_id"`
+	EmployeeID string    `db:"employee_id"`
+	Source     string    `db:"source"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func linksFromDatabase() ([]Link, error) {
+	links := []Link{}
+
+	err := db.Select(&links, "SELECT * FROM links ORDER BY created_at")
+
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting all links")
+	}
+
+	return links, nil
+}
+
+func findLink(column, id string) (*Link, error) {
+	link := Link{}
+
+	err := db.Get(&link, fmt.Sprintf("SELECT * FROM links WHERE %s = $1 LIMIT 1", column), id)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return &link, errors.Wrapf(err, "finding link by %s %s", column, id)
+}
+
+// createLink stores a link, replacing any existing link for the same slack user
+func createLink(link *Link) error {
+	link.CreatedAt = time.Now()
+	lookups.links = nil
+
+	_, err := db.NamedExec(`
+		INSERT INTO links
+		(user_id, employee_id, source, created_at)
+		VALUES
+		(:user_id, :employee_id, :source, :created_at)
+		ON CONFLICT (user_id) DO UPDATE SET
+			employee_id = excluded.employee_id
+			, source = excluded.source
+			, created_at = excluded.created_at
+		`, link)
+
+	return errors.Wrapf(err, "inserting link %#v", link)
+}
+
+// matchEmployee guesses which employee a slack user is, first by email and then by name. Only
+// unambiguous matches count.
+func matchEmployee(user *User, employees []*Employee) (*Employee, string) {
+	if user.Email != "" {
+		if match := onlyEmployee(employees, func(e *Employee) bool {
+			return strings.EqualFold(e.Email, user.Email)
+		}); match != nil {
+			return match, LinkSourceEmail
+		}
+	}
+
+	if user.FirstName() == "" || user.LastName() == "" {
+		return nil, ""
+	}
+
+	if match := onlyEmployee(employees, func(e *Employee) bool {
+		return strings.EqualFold(e.FirstName(), user.FirstName()) && strings.EqualFold(e.LastName(), user.LastName())
+	}); match != nil {
+		return match, LinkSourceName
+	}
+
+	return nil, ""
+}
+
+func onlyEmployee(employees []*Employee, matches func(*Employee) bool) *Employee {
+	var found *Employee
+
+	for _, employee := range employees {
+		if employee.Deleted || !matches(employee) {
+			continue
+		}
+
+		if found != nil {
+			return nil
+		}
+
+		found = employee
+	}
+
+	return found
+}
+
+// matchUser is matchEmployee the other way around
+func matchUser(employee *Employee, users []User) (*User, string) {
+	var found *User
+	var source string
+
+	for i := range users {
+		user := &users[i]
+
+		if user.Deleted {
+			continue
+		}
+
+		if match, matchSource := matchEmployee(user, []*Employee{employee}); match != nil {
+			if found != nil {
+				return nil, ""
+			}
+
+			found, source = user, matchSource
+		}
+	}
+
+	return found, source
+}
+
+// linkLookup is what the link heuristics look through, loaded the first time it's needed rather
+// than for every lookup. A table is loaded again after it's written to, and everything is loaded
+// again each iteration, see withSentry.
+type linkLookup struct {
+	links     []Link
+	employees []*Employee
+	users     []User
+}
+
+var lookups linkLookup
+
+func (lookup *linkLookup) Reset() {
+	*lookup = linkLookup{}
+}
+
+func (lookup *linkLookup) Links() ([]Link, error) {
+	if lookup.links == nil {
+		links, err := linksFromDatabase()
+
+		if err != nil {
+			return nil, err
+		}
+
+		lookup.links = links
+	}
+
+	return lookup.links, nil
+}
+
+func (lookup *linkLookup) Employees() ([]*Employee, error) {
+	if lookup.employees == nil {
+		employees, err := employeesFromDatabase()
+
+		if err != nil {
+			return nil, err
+		}
+
+		lookup.employees = employees
+	}
+
+	return lookup.employees, nil
+}
+
+func (lookup *linkLookup) Users() ([]User, error) {
+	if lookup.users == nil {
+		users, err := usersFromDatabase()
+
+		if err != nil {
+			return nil, err
+		}
+
+		lookup.users = users
+	}
+
+	return lookup.users, nil
+}
+
+// Employee finds an employee by id, nil when there's no such employee
+func (lookup *linkLookup) Employee(id string) (*Employee, error) {
+	employees, err := lookup.Employees()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, employee := range employees {
+		if employee.ID == id {
+			return employee, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// employeeForUser finds the employee a slack user has been linked to, falling back to the
+// heuristics when they haven't been linked yet. Returns nil when there's no good answer.
+func employeeForUser(user *User) (*Employee, error) {
+	links, err := lookups.Links()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		if link.UserID == user.ID {
+			return lookups.Employee(link.EmployeeID)
+		}
+	}
+
+	employees, err := lookups.Employees()
+
+	if err != nil {
+		return nil, err
+	}
+
+	employee, _ := matchEmployee(user, employees)
+
+	return employee, nil
+}
+
+// userForEmployee finds the slack user linked to an employee, falling back to the heuristics when
+// they haven't been linked yet. Returns nil when there's no good answer.
+func userForEmployee(employee *Employee) (*User, error) {
+	links, err := lookups.Links()
+
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := lookups.Users()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		if link.EmployeeID != employee.ID {
+			continue
+		}
+
+		for i := range users {
+			if users[i].ID == link.UserID {
+				return &users[i], nil
+			}
+		}
+
+		return nil, nil
+	}
+
+	user, _ := matchUser(employee, users)
+
+	return user, nil
+}
+
+// suggestLinks proposes links for every living slack user who isn't linked yet
+func suggestLinks() ([]Link, error) {
+	users, err := usersFromDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	employees, err := employeesFromDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := linksFromDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	linked := map[string]bool{}
+
+	for _, link := range links {
+		linked[link.UserID] = true
+	}
+
+	suggestions := []Link{}
+
+	for i := range users {
+		user := &users[i]
+
+		if user.Deleted || linked[user.ID] {
+			continue
+		}
+
+		if employee, source := matchEmployee(user, employees); employee != nil {
+			suggestions = append(suggestions, Link{
+				UserID:     user.ID,
+				EmployeeID: employee.ID,
+				Source:     source,
+			})
+		}
+	}
+
+	return suggestions, nil
+}
+
+func runLinkSuggest(save bool) error {
+	suggestions, err := suggestLinks()
+
+	if err != nil {
+		return errors.Wrap(err, "suggesting links")
+	}
+
+	err = printLinks(suggestions)
+
+	if err != nil || !save {
+		return err
+	}
+
+	for i := range suggestions {
+		err := createLink(&suggestions[i])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Saved %d links\n", len(suggestions))
+
+	return nil
+}
+
+func runLinkSet(userRef, employeeID string) error {
+	user, err := findUser(userRef)
+
+	if err != nil {
+		return err
+	}
+
+	employee, err := FindEmployee(employeeID)
+
+	if err != nil {
+		return err
+	}
+
+	err = createLink(&Link{UserID: user.ID, EmployeeID: employee.ID, Source: LinkSourceManual})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Linked %s to %s\n", user.SomeName(), employee.Name)
+
+	return nil
+}
+
+func runLinkList() error {
+	links, err := linksFromDatabase()
+
+	if err != nil {
+		return err
+	}
+
+	return printLinks(links)
+}
+
+func printLinks(links []Link) error {
+	users, err := usersFromDatabase()
+
+	if err != nil {
+		return err
+	}
+
+	employees, err := employeesFromDatabase()
+
+	if err != nil {
+		return err
+	}
+
+	userNames := map[string]string{}
+	for i := range users {
+		userNames[users[i].ID] = users[i].SomeName()
+	}
+
+	employeeNames := map[string]string{}
+	for _, employee := range employees {
+		employeeNames[employee.ID] = employee.Name
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "USER\tSLACK NAME\tEMPLOYEE\tEMPLOYEE NAME\tSOURCE")
+
+	for _, link := range links {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", link.UserID, userNames[link.UserID], link.EmployeeID, employeeNames[link.EmployeeID], link.Source)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchEmployee(t *testing.T) {
+	employees := []*Employee{
+		{ID: "1", Name: "Taylor, Zach"},
+		{ID: "2", Name: "Jane Doe", Email: "jane@example.com"},
+		{ID: "3", Name: "John Smith"},
+		{ID: "4", Name: "John Smith"},
+	}
+
+	tests := []struct {
+		user   User
+		id     string
+		source string
+	}{
+		{User{RealName: "Zach Taylor"}, "1", LinkSourceName},
+		{User{RealName: "Janie D", Email: "JANE@example.com"}, "2", LinkSourceEmail},
+		{User{RealName: "John Smith"}, "", ""},
+		{User{RealName: "Nobody"}, "", ""},
+	}
+
+	for _, test := range tests {
+		employee, source := matchEmployee(&test.user, employees)
+
+		id := ""
+		if employee != nil {
+			id = employee.ID
+		}
+
+		if id != test.id || source != test.source {
+			t.Errorf("Expected %s(%s) for %s, got %s(%s)", test.id, test.source, test.user.RealName, id, source)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"math/rand"
 	"os"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
@@ -40,6 +42,7 @@ func init() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	slackChannelID = os.Getenv("SLACK_CHANNEL_ID")
 	slackClient = slack.New(os.Getenv("SLACK_TOKEN"))
+	rand.Seed(time.Now().UTC().UnixNano())
 }
 
 func main() {
@@ -55,9 +58,95 @@ func main() {
 		},
 		&cli.StringFlag{
 			Name:  "messenger",
-			Usage: "send messages to stdout or slack",
+			Usage: "send messages to stdout, slack, webhook, teams, discord, mattermost, email or jsonl",
 			Value: "slack",
 		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "show the database changes and messages a command would make, without making them",
+		},
+		&cli.StringFlag{
+			Name:  "dry-run-format",
+			Usage: "print the dry run's plan as text or json",
+			Value: "text",
+		},
+		&cli.StringFlag{
+			Name:   "jsonl-file",
+			Usage:  "file for the jsonl messenger to write to, stdout by default",
+			EnvVar: "TRAIL_JSONL_FILE",
+		},
+		&cli.IntFlag{
+			Name:   "jsonl-max-size",
+			Usage:  "megabytes the jsonl file can grow to before it's rotated, 0 to never rotate",
+			EnvVar: "TRAIL_JSONL_MAX_SIZE",
+			Value:  jsonlMaxSize,
+		},
+		&cli.IntFlag{
+			Name:   "jsonl-max-files",
+			Usage:  "rotated jsonl files to keep",
+			EnvVar: "TRAIL_JSONL_MAX_FILES",
+			Value:  jsonlMaxFiles,
+		},
+		&cli.DurationFlag{
+			Name:   "webhook-timeout",
+			Usage:  "timeout for each webhook request, including chat tools' webhooks",
+			EnvVar: "TRAIL_WEBHOOK_TIMEOUT",
+			Value:  webhookTimeout,
+		},
+		&cli.IntFlag{
+			Name:   "webhook-retries",
+			Usage:  "how many times to retry a webhook that timed out or hit a server error",
+			EnvVar: "TRAIL_WEBHOOK_RETRIES",
+			Value:  webhookRetries,
+		},
+		&cli.StringFlag{
+			Name:   "digests",
+			Usage:  "json, or a json file, of channels that get a daily or weekly trail report instead of every event",
+			EnvVar: "TRAIL_DIGESTS",
+		},
+		&cli.StringFlag{
+			Name:   "routes",
+			Usage:  "json, or a json file, of rules for which channels get which events",
+			EnvVar: "TRAIL_ROUTES",
+		},
+		&cli.StringFlag{
+			Name:   "fates",
+			Usage:  "json, or a json file, of fates to choose from for deaths",
+			EnvVar: "TRAIL_FATES",
+		},
+		&cli.Float64Flag{
+			Name:   "journey-years",
+			Usage:  "years it takes to travel the whole trail",
+			EnvVar: "TRAIL_JOURNEY_YEARS",
+			Value:  5,
+		},
+		&cli.StringFlag{
+			Name:   "images",
+			Usage:  "illustrate announcements with images from none, google or dir",
+			EnvVar: "TRAIL_IMAGES",
+			Value:  "none",
+		},
+		&cli.StringFlag{
+			Name:   "images-dir",
+			Usage:  "directory of images with a subdirectory for birth, death and emoji, for the dir images in slack",
+			EnvVar: "TRAIL_IMAGES_DIR",
+		},
+		&cli.BoolTFlag{
+			Name:   "tombstones",
+			Usage:  "draw tombstones for death announcements in slack",
+			EnvVar: "TRAIL_TOMBSTONES",
+		},
+		&cli.StringFlag{
+			Name:   "directory",
+			Usage:  "get employees from ultipro, bamboohr, ldap, csv or ldif",
+			EnvVar: "TRAIL_DIRECTORY",
+			Value:  "ultipro",
+		},
+		&cli.StringFlag{
+			Name:   "directory-file",
+			Usage:  "file to read employees from for the csv and ldif directories",
+			EnvVar: "TRAIL_DIRECTORY_FILE",
+		},
 	}
 
 	app.Before = func(c *cli.Context) error {
@@ -72,16 +161,88 @@ func main() {
 		})
 
 		verbose = c.Bool("verbose")
-		switch c.String("messenger") {
-		case "stdout":
-			sendMessage = messageStdout
-		case "slack":
-			sendMessage = messageSlack
-		default:
-			return fmt.Errorf("unsupported messenger %s", c.String("messenger"))
+		webhookTimeout = c.Duration("webhook-timeout")
+		webhookRetries = c.Int("webhook-retries")
+		jsonlFile = c.String("jsonl-file")
+		jsonlMaxSize = c.Int("jsonl-max-size")
+		jsonlMaxFiles = c.Int("jsonl-max-files")
+
+		var err error
+		sendMessage, err = newMessenger(c.String("messenger"))
+
+		if err != nil {
+			return err
+		}
+
+		sendMessage = withMessengerChannels(sendMessage)
+		webhookURLs = splitURLs(os.Getenv("WEBHOOK_URLS"))
+
+		tombstones = c.BoolT("tombstones") && c.String("messenger") == "slack"
+
+		journeyYears = c.Float64("journey-years")
+
+		if journeyYears <= 0 {
+			return fmt.Errorf("journey years should be positive, got %v", journeyYears)
+		}
+
+		directory, err = newDirectoryProvider(c.String("directory"), c.String("directory-file"))
+
+		if err != nil {
+			return err
+		}
+
+		imageKind := c.String("images")
+
+		// Images from a directory only have a url once they're uploaded to slack
+		if imageKind == "dir" && c.String("messenger") != "slack" {
+			imageKind = "none"
+		}
+
+		images, err = newImageProvider(imageKind, c.String("images-dir"))
+
+		if err != nil {
+			return err
+		}
+
+		fates, err = loadFates(c.String("fates"))
+
+		if err != nil {
+			return err
+		}
+
+		digests, err = loadDigests(c.String("digests"))
+
+		if err != nil {
+			return err
+		}
+
+		routes, err = loadRoutes(c.String("routes"))
+
+		if err != nil {
+			return err
+		}
+
+		if !c.Bool("dry-run") {
+			return nil
+		}
+
+		if aws {
+			return errors.New("dry runs are for running locally")
 		}
 
-		return nil
+		if format := c.String("dry-run-format"); format != "text" && format != "json" {
+			return fmt.Errorf("unsupported dry run format %s", format)
+		}
+
+		return startDryRun()
+	}
+
+	app.After = func(c *cli.Context) error {
+		if dryRun == nil {
+			return nil
+		}
+
+		return finishDryRun(os.Stdout, c.String("dry-run-format"))
 	}
 
 	app.Commands = []cli.Command{
@@ -115,6 +276,28 @@ func main() {
 				}
 			},
 		},
+		{
+			Name:  "digest",
+			Usage: "post trail reports for channels whose digest is due",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "post every pending digest even if it's not due",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				run := func() error {
+					return runDigestIteration(c.Bool("force"))
+				}
+
+				if aws {
+					lambda.Start(withSentry(run))
+					return nil
+				} else {
+					return run()
+				}
+			},
+		},
 		{
 			Name:  "emojis",
 			Usage: "check for emoji changes",
@@ -137,7 +320,44 @@ func main() {
 		{
 			Name:  "employees",
 			Usage: "check for employees changes",
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:   "await-slack",
+					Usage:  "hold new hire announcements until they have a slack user, for at most this long",
+					EnvVar: "TRAIL_AWAIT_SLACK",
+				},
+				&cli.IntFlag{
+					Name:   "reorg-threshold",
+					Usage:  "people moving between the same supervisors at once to announce as one reorg, 0 to disable",
+					EnvVar: "TRAIL_REORG_THRESHOLD",
+					Value:  reorgThreshold,
+				},
+				&cli.IntFlag{
+					Name:   "ultipro-concurrency",
+					Usage:  "how many org chart requests to make at once",
+					EnvVar: "ULTIPRO_CONCURRENCY",
+					Value:  ultiproConcurrency,
+				},
+				&cli.DurationFlag{
+					Name:   "ultipro-timeout",
+					Usage:  "timeout for each org chart request",
+					EnvVar: "ULTIPRO_TIMEOUT",
+					Value:  ultiproTimeout,
+				},
+				&cli.IntFlag{
+					Name:   "ultipro-retries",
+					Usage:  "how many times to retry an org chart request that timed out or hit a server error",
+					EnvVar: "ULTIPRO_RETRIES",
+					Value:  ultiproRetries,
+				},
+			},
 			Action: func(c *cli.Context) error {
+				awaitSlack = c.Duration("await-slack")
+				reorgThreshold = c.Int("reorg-threshold")
+				ultiproConcurrency = c.Int("ultipro-concurrency")
+				ultiproTimeout = c.Duration("ultipro-timeout")
+				ultiproRetries = c.Int("ultipro-retries")
+
 				if aws {
 					lambda.Start(withSentry(runEmployeesIteration))
 					return nil
@@ -146,6 +366,266 @@ func main() {
 				}
 			},
 		},
+		{
+			Name:  "anniversaries",
+			Usage: "celebrate slack and work anniversaries",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:   "milestones",
+					Usage:  "comma separated years to celebrate e.g. 1,5,10, empty for every year",
+					EnvVar: "TRAIL_ANNIVERSARY_MILESTONES",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var err error
+				anniversaryMilestones, err = parseMilestones(c.String("milestones"))
+
+				if err != nil {
+					return err
+				}
+
+				if aws {
+					lambda.Start(withSentry(runAnniversariesIteration))
+					return nil
+				} else {
+					return runAnniversariesIteration()
+				}
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:      "opt-out",
+					Usage:     "stop celebrating a slack user's anniversaries",
+					ArgsUsage: "<slack user id or name>",
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("expected a slack user, got %v", c.Args())
+						}
+
+						return runAnniversariesOptOut(c.Args().Get(0), true)
+					},
+				},
+				{
+					Name:      "opt-in",
+					Usage:     "start celebrating a slack user's anniversaries again",
+					ArgsUsage: "<slack user id or name>",
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("expected a slack user, got %v", c.Args())
+						}
+
+						return runAnniversariesOptOut(c.Args().Get(0), false)
+					},
+				},
+			},
+		},
+		{
+			Name:  "backfill",
+			Usage: "fill in history we didn't record at the time",
+			Subcommands: []cli.Command{
+				{
+					Name:  "join-dates",
+					Usage: "estimate when slack users joined from slack and hr records",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:   "channel",
+							Usage:  "channel everybody joins, to find join and first messages in",
+							EnvVar: "TRAIL_BACKFILL_CHANNEL_ID",
+						},
+						&cli.BoolFlag{
+							Name:  "save",
+							Usage: "store the estimated join dates",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return runBackfillJoinDates(c.String("channel"), c.Bool("save"))
+					},
+				},
+			},
+		},
+		{
+			Name:  "audit",
+			Usage: "audit slack and hr records",
+			Subcommands: []cli.Command{
+				{
+					Name:  "accounts",
+					Usage: "list slack users with no employee and employees with no slack user",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "print the report as text or csv",
+							Value: "text",
+						},
+						&cli.BoolFlag{
+							Name:  "post",
+							Usage: "also post a summary to the messenger",
+						},
+						&cli.BoolFlag{
+							Name:  "include-guests",
+							Usage: "report guests without an employee too",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						run := func() error {
+							return runAuditAccounts(c.String("format"), c.Bool("post"), c.Bool("include-guests"))
+						}
+
+						if aws {
+							lambda.Start(withSentry(run))
+							return nil
+						} else {
+							return run()
+						}
+					},
+				},
+			},
+		},
+		{
+			Name:      "journey",
+			Usage:     "show how far a slack user is along the trail, and what happened on the way",
+			ArgsUsage: "<slack user id or name>",
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("expected a slack user, got %v", c.Args())
+				}
+
+				return runJourney(c.Args().Get(0))
+			},
+		},
+		{
+			Name:  "link",
+			Usage: "link slack users to employees",
+			Subcommands: []cli.Command{
+				{
+					Name:  "suggest",
+					Usage: "suggest links for unlinked slack users by email and name",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  "save",
+							Usage: "store the suggested links",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return runLinkSuggest(c.Bool("save"))
+					},
+				},
+				{
+					Name:      "set",
+					Usage:     "manually link a slack user to an employee",
+					ArgsUsage: "<slack user id or name> <employee id>",
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 2 {
+							return fmt.Errorf("expected a slack user and an employee id, got %v", c.Args())
+						}
+
+						return runLinkSet(c.Args().Get(0), c.Args().Get(1))
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "list linked slack users and employees",
+					Action: func(c *cli.Context) error {
+						return runLinkList()
+					},
+				},
+			},
+		},
+		{
+			Name:  "orgchart",
+			Usage: "print the org chart from the employees table",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "render as text, dot, mermaid or json",
+					Value: "text",
+				},
+				&cli.StringFlag{
+					Name:  "root",
+					Usage: "employee id to start the chart from",
+				},
+				&cli.IntFlag{
+					Name:  "depth",
+					Usage: "levels of reports to include below the root, 0 for all",
+				},
+				&cli.StringFlag{
+					Name:  "at",
+					Usage: "show the org chart as of a date e.g. 2026-06-01",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return runOrgChart(c.String("format"), c.String("root"), c.Int("depth"), c.String("at"))
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:      "diff",
+					Usage:     "show who joined, left and moved between two dates",
+					ArgsUsage: "<from date> <to date>",
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 2 {
+							return fmt.Errorf("expected two dates, got %v", c.Args())
+						}
+
+						return runOrgChartDiff(c.Args().Get(0), c.Args().Get(1))
+					},
+				},
+			},
+		},
+		{
+			Name:  "render",
+			Usage: "draw images locally to preview them",
+			Subcommands: []cli.Command{
+				{
+					Name:      "tombstone",
+					Usage:     "draw a slack user's tombstone",
+					ArgsUsage: "<slack user id or name>",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "fate",
+							Usage: "how they died e.g. \"died of Dysentery\", their usual fate by default",
+						},
+						&cli.StringFlag{
+							Name:  "out",
+							Usage: "png file to write",
+							Value: "tombstone.png",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("expected a slack user, got %v", c.Args())
+						}
+
+						return runRenderTombstone(c.Args().Get(0), c.String("fate"), c.String("out"))
+					},
+				},
+			},
+		},
+		{
+			Name:  "routes",
+			Usage: "check where events are announced",
+			Subcommands: []cli.Command{
+				{
+					Name:      "test",
+					Usage:     "show which channels an event would be announced in",
+					ArgsUsage: "<event kind>",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "user",
+							Usage: "slack user id or name the event is about",
+						},
+						&cli.StringFlag{
+							Name:  "employee",
+							Usage: "employee id the event is about",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("expected an event kind, got %v", c.Args())
+						}
+
+						return runRoutesTest(c.Args().Get(0), c.String("user"), c.String("employee"))
+					},
+				},
+			},
+		},
 		{
 			Name:  "test",
 			Usage: "manual testing",
@@ -158,7 +638,7 @@ func main() {
 					Name:  "message",
 					Usage: "post test message to the messenger",
 					Action: func(c *cli.Context) error {
-						err := sendMessage("Testing, testing, 123...", ":rip:")
+						err := sendMessage(Message{Text: "Testing, testing, 123...", Emoji: ":rip:"})
 						return errors.Wrap(err, "sending slack message")
 					},
 				},
@@ -179,9 +659,11 @@ func main() {
 	}
 	args := os.Args
 	if aws {
-		args = append(args, os.Getenv("COMMAND"))
+		// COMMAND can include subcommands and flags e.g. "audit accounts --post"
+		args = append(args, strings.Fields(os.Getenv("COMMAND"))...)
 	}
-	fmt.Println(args)
+	// stderr, so stdout is only messages for the jsonl messenger
+	fmt.Fprintln(os.Stderr, args)
 	err := app.Run(args)
 
 	if err != nil {
@@ -189,37 +671,117 @@ func main() {
 	}
 }
 
-// Oregon Trail Diseases:
-var diseases = []string{
-	"Dysentery",
-	"Typhoid Fever",
-	"Cholera",
-	"Diphtheria",
-	"Measles",
-	"Thirst Traps",
+// Message is what messengers send. Text is always set, even when there are blocks, for messengers
+// and notifications that can't show them.
+type Message struct {
+	Channel     string
+	Text        string
+	Emoji       string
+	Attachments []slack.Attachment
+	Blocks      []slack.Block
+	// Event is what the message announces, if it's about one, for messengers that send data
+	Event *Event
 }
 
-func randomDisease() string {
-	rand.Seed(time.Now().UTC().UnixNano())
-	disease := diseases[rand.Intn(len(diseases))]
-	return disease
+type messageFunc func(Message) error
+
+func newMessenger(kind string) (messageFunc, error) {
+	switch kind {
+	case "stdout":
+		return messageStdout, nil
+	case "slack":
+		return messageSlack, nil
+	case "webhook":
+		return newWebhookMessenger(os.Getenv("WEBHOOK_URLS"), os.Getenv("WEBHOOK_SECRET"))
+	case "teams", "discord", "mattermost":
+		return newChatMessenger(kind)
+	case "email":
+		return newEmailMessenger(os.Getenv("EMAIL_TO"))
+	case "jsonl":
+		return newJSONLMessenger(jsonlFile, int64(jsonlMaxSize)*1024*1024, jsonlMaxFiles), nil
+	default:
+		return nil, fmt.Errorf("unsupported messenger %s", kind)
+	}
 }
 
-type messageFunc func(string, string, ...slack.Attachment) error
+// channelMessengers can be picked per channel, by routing or digesting to a channel like
+// teams:<webhook url> or email:<addresses>
+var channelMessengers = map[string]func(destination string) messageFunc{
+	"webhook":    newWebhookMessengerTo,
+	"teams":      newTeamsMessenger,
+	"discord":    newDiscordMessenger,
+	"mattermost": newMattermostMessenger,
+	"email":      newEmailMessengerTo,
+}
+
+// messengerChannel splits a channel like discord:https://discord.com/api/webhooks/1/x into the
+// messenger and where it sends to
+func messengerChannel(channel string) (string, string, bool) {
+	i := strings.Index(channel, ":")
+
+	if i < 0 {
+		return "", "", false
+	}
+
+	if _, ok := channelMessengers[channel[:i]]; !ok {
+		return "", "", false
+	}
+
+	return channel[:i], channel[i+1:], true
+}
+
+// withMessengerChannels sends messages for messenger channels with that messenger, and everything
+// else with the --messenger. Each channel's messenger is made once, the first time it's sent to.
+func withMessengerChannels(send messageFunc) messageFunc {
+	var mu sync.Mutex
+	messengers := map[string]messageFunc{}
 
-func messageStdout(text string, emoji string, attachments ...slack.Attachment) error {
-	fmt.Printf("%s %s\n", emoji, text)
+	return func(message Message) error {
+		kind, destination, ok := messengerChannel(message.Channel)
+
+		if !ok {
+			return send(message)
+		}
+
+		mu.Lock()
+		messenger, ok := messengers[message.Channel]
+
+		if !ok {
+			messenger = channelMessengers[kind](destination)
+			messengers[message.Channel] = messenger
+		}
+
+		mu.Unlock()
+
+		message.Channel = ""
+
+		return messenger(message)
+	}
+}
+
+func messageStdout(message Message) error {
+	fmt.Printf("%s %s\n", message.Emoji, message.Text)
 	return nil
 }
 
-func messageSlack(text string, emoji string, attachments ...slack.Attachment) error {
-	_, _, err := slackClient.PostMessage(
-		slackChannelID,
+func messageSlack(message Message) error {
+	channel := message.Channel
+	if channel == "" {
+		channel = slackChannelID
+	}
+
+	options := []slack.MsgOption{
 		slack.MsgOptionUsername("trail"),
-		slack.MsgOptionIconEmoji(emoji),
-		slack.MsgOptionText(text, false),
-		slack.MsgOptionAttachments(attachments...),
-	)
+		slack.MsgOptionIconEmoji(message.Emoji),
+		slack.MsgOptionText(message.Text, false),
+		slack.MsgOptionAttachments(message.Attachments...),
+	}
+
+	if len(message.Blocks) > 0 {
+		options = append(options, slack.MsgOptionBlocks(message.Blocks...))
+	}
+
+	_, _, err := slackClient.PostMessage(channel, options...)
 
 	return errors.Wrap(err, "sending a slack message")
 }
@@ -227,7 +789,10 @@ func messageSlack(text string, emoji string, attachments ...slack.Attachment) er
 func withSentry(f func() error) func() error {
 	function := f
 	return func() error {
-		fmt.Println("Starting iteration...")
+		fmt.Fprintln(os.Stderr, "Starting iteration...")
+
+		// Lambdas are reused between runs, what the last run loaded is out of date
+		lookups.Reset()
 
 		defer sentry.Flush(2 * time.Second)
 		defer sentry.Recover()
@@ -235,11 +800,11 @@ func withSentry(f func() error) func() error {
 		err := function()
 
 		if err != nil {
-			fmt.Printf("Something broke :(\n%s\n", err.Error())
+			fmt.Fprintf(os.Stderr, "Something broke :(\n%s\n", err.Error())
 			sentry.CaptureException(err)
 		}
 
-		fmt.Println("Finished iteration.")
+		fmt.Fprintln(os.Stderr, "Finished iteration.")
 
 		return err
 	}
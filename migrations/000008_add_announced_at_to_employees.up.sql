@@ -0,0 +1,4 @@
+ALTER TABLE employees ADD COLUMN announced_at timestamp;
+
+-- Everyone we already know about was there before announcements existed
+UPDATE employees SET announced_at = created_at;
@@ -0,0 +1,4 @@
+DROP TABLE links;
+
+ALTER TABLE employees DROP column email;
+ALTER TABLE users DROP column email;
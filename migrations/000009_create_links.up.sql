@@ -0,0 +1,11 @@
+ALTER TABLE users ADD column email varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE employees ADD column email varchar(255) NOT NULL DEFAULT '';
+
+CREATE TABLE links (
+  user_id varchar(255) NOT NULL,
+  employee_id text NOT NULL,
+  source varchar(255) NOT NULL,
+  created_at timestamp with time zone not null default current_timestamp
+);
+
+ALTER TABLE links ADD CONSTRAINT unique_user_id_on_links UNIQUE (user_id);
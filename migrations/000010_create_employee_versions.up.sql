@@ -0,0 +1,27 @@
+CREATE TABLE employee_versions (
+  employee_id text NOT NULL
+  , name text NOT NULL
+  , supervisor_id text
+  , reports_count int NOT NULL
+  , deleted boolean NOT NULL DEFAULT 'f'
+  , valid_from timestamp with time zone NOT NULL
+  , valid_to timestamp with time zone
+);
+
+CREATE INDEX index_employee_versions_on_employee_id ON employee_versions (employee_id);
+CREATE INDEX index_employee_versions_on_valid_from_and_valid_to ON employee_versions (valid_from, valid_to);
+
+-- History starts with whatever we know right now, the best we can do for departures is assume
+-- nothing else changed before they left. Employees who departed before we kept track of when are
+-- left out of history entirely.
+INSERT INTO employee_versions
+  (employee_id, name, supervisor_id, reports_count, deleted, valid_from, valid_to)
+SELECT id, name, supervisor_id, reports_count, 'f', created_at,
+  CASE WHEN deleted AND deleted_at IS NULL THEN created_at ELSE deleted_at END
+FROM employees;
+
+INSERT INTO employee_versions
+  (employee_id, name, supervisor_id, reports_count, deleted, valid_from)
+SELECT id, name, supervisor_id, reports_count, 't', deleted_at
+FROM employees
+WHERE deleted AND deleted_at IS NOT NULL;
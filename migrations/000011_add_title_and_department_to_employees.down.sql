@@ -0,0 +1,2 @@
+ALTER TABLE employees DROP column department;
+ALTER TABLE employees DROP column title;
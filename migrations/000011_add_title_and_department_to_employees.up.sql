@@ -0,0 +1,4 @@
+ALTER TABLE employees
+  ADD column title text NOT NULL DEFAULT '',
+  ADD column department text NOT NULL DEFAULT ''
+;
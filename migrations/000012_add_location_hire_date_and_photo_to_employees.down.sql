@@ -0,0 +1,7 @@
+ALTER TABLE employee_versions DROP column location;
+ALTER TABLE employee_versions DROP column department;
+ALTER TABLE employee_versions DROP column title;
+
+ALTER TABLE employees DROP column photo_url;
+ALTER TABLE employees DROP column hired_at;
+ALTER TABLE employees DROP column location;
@@ -0,0 +1,11 @@
+ALTER TABLE employees
+  ADD column location text NOT NULL DEFAULT '',
+  ADD column hired_at date,
+  ADD column photo_url text NOT NULL DEFAULT ''
+;
+
+ALTER TABLE employee_versions
+  ADD column title text NOT NULL DEFAULT '',
+  ADD column department text NOT NULL DEFAULT '',
+  ADD column location text NOT NULL DEFAULT ''
+;
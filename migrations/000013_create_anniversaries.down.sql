@@ -0,0 +1,2 @@
+DROP TABLE anniversary_opt_outs;
+DROP TABLE anniversaries;
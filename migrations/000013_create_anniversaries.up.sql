@@ -0,0 +1,15 @@
+CREATE TABLE anniversaries (
+  kind varchar(255) NOT NULL,
+  subject_id text NOT NULL,
+  years int NOT NULL,
+  celebrated_on date NOT NULL
+);
+
+ALTER TABLE anniversaries ADD CONSTRAINT unique_kind_subject_id_years_on_anniversaries UNIQUE (kind, subject_id, years);
+
+CREATE TABLE anniversary_opt_outs (
+  user_id varchar(255) NOT NULL,
+  created_at timestamp with time zone not null default current_timestamp
+);
+
+ALTER TABLE anniversary_opt_outs ADD CONSTRAINT unique_user_id_on_anniversary_opt_outs UNIQUE (user_id);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP column created_at_confidence;
+ALTER TABLE users DROP column created_at_source;
@@ -0,0 +1,23 @@
+ALTER TABLE users
+  ADD column created_at_source varchar(255) NOT NULL DEFAULT 'unknown',
+  ADD column created_at_confidence real NOT NULL DEFAULT 0
+;
+
+-- Users from before 000002 were all given the same made up date
+UPDATE users SET created_at_source = 'default' WHERE created_at = '2019-01-01 12:00:00 America/Chicago';
+
+-- Users from trail init were all created in the same minute, no real sign up day looks like that
+UPDATE users SET created_at_source = 'init', created_at_confidence = 0
+WHERE
+  created_at_source = 'unknown'
+  AND date_trunc('minute', created_at) IN (
+    SELECT date_trunc('minute', created_at)
+    FROM users
+    WHERE created_at_source = 'unknown'
+    GROUP BY 1
+    HAVING count(*) >= 10
+  );
+
+-- Everyone else was created when the users detector first saw them
+UPDATE users SET created_at_source = 'observed', created_at_confidence = 1
+WHERE created_at_source = 'unknown';
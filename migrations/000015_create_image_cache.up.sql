@@ -0,0 +1,7 @@
+CREATE TABLE image_cache (
+  key text NOT NULL,
+  urls text[] NOT NULL,
+  cached_at timestamp with time zone not null default current_timestamp
+);
+
+ALTER TABLE image_cache ADD CONSTRAINT unique_key_on_image_cache UNIQUE (key);
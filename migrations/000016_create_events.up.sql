@@ -0,0 +1,22 @@
+-- Events are recorded before they're sent, an event is delivered once every channel has it
+CREATE TABLE events (
+  id serial PRIMARY KEY,
+  kind varchar(255) NOT NULL,
+  user_id varchar(255),
+  employee_id text,
+  text text NOT NULL,
+  emoji varchar(255) NOT NULL,
+  created_at timestamp with time zone not null default current_timestamp,
+  delivered_at timestamp with time zone
+);
+
+CREATE INDEX index_events_on_user_id ON events (user_id);
+CREATE INDEX index_events_on_employee_id ON events (employee_id);
+
+CREATE TABLE event_deliveries (
+  event_id int NOT NULL,
+  channel text NOT NULL,
+  delivered_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE event_deliveries ADD CONSTRAINT unique_event_id_channel_on_event_deliveries UNIQUE (event_id, channel);
@@ -0,0 +1,8 @@
+CREATE TABLE digest_items (
+  event_id int NOT NULL,
+  channel varchar(255) NOT NULL,
+  digested_at timestamp with time zone
+);
+
+ALTER TABLE digest_items ADD CONSTRAINT unique_event_id_channel_on_digest_items UNIQUE (event_id, channel);
+CREATE INDEX index_digest_items_on_channel_and_digested_at ON digest_items (channel, digested_at);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN bot;
+ALTER TABLE users DROP COLUMN guest;
+ALTER TABLE users DROP COLUMN admin;
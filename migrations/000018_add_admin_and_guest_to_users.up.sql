@@ -0,0 +1,6 @@
+-- Admin is left unknown until users are next synced, so existing admins aren't announced as new ones
+ALTER TABLE users ADD COLUMN admin boolean;
+ALTER TABLE users ADD COLUMN guest boolean NOT NULL DEFAULT 'f';
+ALTER TABLE users ADD COLUMN bot boolean NOT NULL DEFAULT 'f';
+
+UPDATE users SET bot = 't' WHERE id = 'USLACKBOT';
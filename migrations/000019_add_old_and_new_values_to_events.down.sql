@@ -0,0 +1,2 @@
+ALTER TABLE events DROP COLUMN new_value;
+ALTER TABLE events DROP COLUMN old_value;
@@ -0,0 +1,2 @@
+ALTER TABLE events ADD COLUMN old_value text NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN new_value text NOT NULL DEFAULT '';
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type OrgNode struct {
+	Employee *Employee
+	Reports  []*OrgNode
+}
+
+// buildOrgChart turns the flat list of employees back into trees. Without a root every employee
+// whose supervisor we don't know about is a root. Depth limits how many levels of reports are
+// included below the root, zero means no limit.
+func buildOrgChart(employees []*Employee, rootID string, depth int) ([]*OrgNode, error) {
+	lookup := map[string]*Employee{}
+	reports := map[string][]*Employee{}
+
+	for _, employee := range employees {
+		if employee.Deleted {
+			continue
+		}
+
+		lookup[employee.ID] = employee
+	}
+
+	for _, employee := range lookup {
+		reports[employee.SupervisorID] = append(reports[employee.SupervisorID], employee)
+	}
+
+	for _, r := range reports {
+		sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	}
+
+	roots := []*Employee{}
+
+	if rootID != "" {
+		root, ok := lookup[rootID]
+
+		if !ok {
+			return nil, fmt.Errorf("no active employee with id %s", rootID)
+		}
+
+		roots = append(roots, root)
+	} else {
+		for _, employee := range lookup {
+			if _, ok := lookup[employee.SupervisorID]; !ok || employee.SupervisorID == employee.ID {
+				roots = append(roots, employee)
+			}
+		}
+
+		sort.Slice(roots, func(i, j int) bool { return roots[i].Name < roots[j].Name })
+	}
+
+	visited := map[string]bool{}
+
+	var build func(employee *Employee, level int) *OrgNode
+	build = func(employee *Employee, level int) *OrgNode {
+		node := &OrgNode{Employee: employee}
+		visited[employee.ID] = true
+
+		if depth > 0 && level >= depth {
+			return node
+		}
+
+		for _, report := range reports[employee.ID] {
+			// NOTE: Bad data could make a supervisor loop, so only ever visit someone once
+			if visited[report.ID] {
+				continue
+			}
+
+			node.Reports = append(node.Reports, build(report, level+1))
+		}
+
+		return node
+	}
+
+	nodes := []*OrgNode{}
+
+	for _, root := range roots {
+		nodes = append(nodes, build(root, 0))
+	}
+
+	return nodes, nil
+}
+
+func (node *OrgNode) walk(f func(parent, node *OrgNode, level int)) {
+	var walk func(parent, node *OrgNode, level int)
+	walk = func(parent, node *OrgNode, level int) {
+		f(parent, node, level)
+
+		for _, report := range node.Reports {
+			walk(node, report, level+1)
+		}
+	}
+
+	walk(nil, node, 0)
+}
+
+func renderOrgChartText(w io.Writer, roots []*OrgNode) error {
+	for _, root := range roots {
+		root.walk(func(parent, node *OrgNode, level int) {
+			fmt.Fprintf(w, "%s%s (%d)\n", strings.Repeat("  ", level), node.Employee.Name, node.Employee.ReportsCount)
+		})
+	}
+
+	return nil
+}
+
+func renderOrgChartDOT(w io.Writer, roots []*OrgNode) error {
+	fmt.Fprintln(w, "digraph orgchart {")
+	fmt.Fprintln(w, "  node [shape=box];")
+
+	for _, root := range roots {
+		root.walk(func(parent, node *OrgNode, level int) {
+			fmt.Fprintf(w, "  %q [label=%q];\n", node.Employee.ID, node.Employee.Name)
+
+			if parent != nil {
+				fmt.Fprintf(w, "  %q -> %q;\n", parent.Employee.ID, node.Employee.ID)
+			}
+		})
+	}
+
+	fmt.Fprintln(w, "}")
+
+	return nil
+}
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func renderOrgChartMermaid(w io.Writer, roots []*OrgNode) error {
+	id := func(node *OrgNode) string {
+		return "e_" + mermaidUnsafe.ReplaceAllString(node.Employee.ID, "_")
+	}
+
+	fmt.Fprintln(w, "graph TD")
+
+	for _, root := range roots {
+		root.walk(func(parent, node *OrgNode, level int) {
+			fmt.Fprintf(w, "  %s[\"%s\"]\n", id(node), strings.ReplaceAll(node.Employee.Name, `"`, "#quot;"))
+
+			if parent != nil {
+				fmt.Fprintf(w, "  %s --> %s\n", id(parent), id(node))
+			}
+		})
+	}
+
+	return nil
+}
+
+type orgChartJSON struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	ReportsCount int             `json:"reports_count"`
+	Reports      []*orgChartJSON `json:"reports,omitempty"`
+}
+
+func (node *OrgNode) toJSON() *orgChartJSON {
+	j := &orgChartJSON{
+		ID:           node.Employee.ID,
+		Name:         node.Employee.Name,
+		ReportsCount: node.Employee.ReportsCount,
+	}
+
+	for _, report := range node.Reports {
+		j.Reports = append(j.Reports, report.toJSON())
+	}
+
+	return j
+}
+
+func renderOrgChartJSON(w io.Writer, roots []*OrgNode) error {
+	trees := []*orgChartJSON{}
+
+	for _, root := range roots {
+		trees = append(trees, root.toJSON())
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(trees)
+}
+
+func renderOrgChart(w io.Writer, roots []*OrgNode, format string) error {
+	switch format {
+	case "text":
+		return renderOrgChartText(w, roots)
+	case "dot":
+		return renderOrgChartDOT(w, roots)
+	case "mermaid":
+		return renderOrgChartMermaid(w, roots)
+	case "json":
+		return renderOrgChartJSON(w, roots)
+	default:
+		return fmt.Errorf("unsupported format %s", format)
+	}
+}
+
+func runOrgChart(format, rootID string, depth int, at string) error {
+	var employees []*Employee
+	var err error
+
+	if at == "" {
+		employees, err = employeesFromDatabase()
+	} else {
+		var t time.Time
+		t, err = parseDate(at)
+
+		if err != nil {
+			return err
+		}
+
+		employees, err = employeesAt(t)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	roots, err := buildOrgChart(employees, rootID, depth)
+
+	if err != nil {
+		return errors.Wrap(err, "building org chart")
+	}
+
+	return renderOrgChart(os.Stdout, roots, format)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOrgChart(t *testing.T) {
+	employees := []*Employee{
+		{ID: "1", Name: "Adam", ReportsCount: 2},
+		{ID: "2", Name: "Zoe", SupervisorID: "1", ReportsCount: 1},
+		{ID: "3", Name: "Bob", SupervisorID: "1"},
+		{ID: "4", Name: "Cat", SupervisorID: "2"},
+		{ID: "5", Name: "Gone", SupervisorID: "1", Deleted: true},
+	}
+
+	tests := []struct {
+		root     string
+		depth    int
+		format   string
+		expected string
+	}{
+		{"", 0, "text", "Adam (2)\n  Bob (0)\n  Zoe (1)\n    Cat (0)\n"},
+		{"2", 0, "text", "Zoe (1)\n  Cat (0)\n"},
+		{"", 1, "mermaid", "graph TD\n  e_1[\"Adam\"]\n  e_3[\"Bob\"]\n  e_1 --> e_3\n  e_2[\"Zoe\"]\n  e_1 --> e_2\n"},
+	}
+
+	for _, test := range tests {
+		roots, err := buildOrgChart(employees, test.root, test.depth)
+
+		if err != nil {
+			t.Fatalf("Error building org chart %v", err)
+		}
+
+		var out bytes.Buffer
+
+		err = renderOrgChart(&out, roots, test.format)
+
+		if err != nil {
+			t.Fatalf("Error rendering org chart %v", err)
+		}
+
+		if out.String() != test.expected {
+			t.Errorf("Expected\n%s\ngot\n%s", test.expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// dryRun is what a run would have done, it's only set with the --dry-run flag. Everything happens
+// in a transaction that's rolled back, so later steps see earlier ones' changes, and messages are
+// collected instead of sent.
+var dryRun *Plan
+
+// Plan is the database changes and messages a dry run would have made
+type Plan struct {
+	Mutations []PlannedMutation `json:"mutations"`
+	Messages  []jsonlRecord     `json:"messages"`
+
+	tx *sqlx.Tx
+}
+
+type PlannedMutation struct {
+	Statement string        `json:"statement"`
+	Args      []interface{} `json:"args"`
+	Rows      int64         `json:"rows"`
+}
+
+func startDryRun() error {
+	tx, err := connection.Beginx()
+
+	if err != nil {
+		return errors.Wrap(err, "starting the dry run transaction")
+	}
+
+	dryRun = &Plan{tx: tx}
+	db = planningDB{Tx: tx, Plan: dryRun}
+	sendMessage = dryRun.Message
+
+	// Tombstones and curated images are uploaded to slack, which isn't much of a dry run
+	tombstones = false
+	images = noImages{}
+
+	return nil
+}
+
+// finishDryRun throws away the dry run's changes and prints what they would have been
+func finishDryRun(w io.Writer, format string) error {
+	err := dryRun.tx.Rollback()
+
+	if err != nil && err != sql.ErrTxDone {
+		return errors.Wrap(err, "rolling back the dry run")
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return errors.Wrap(encoder.Encode(dryRun), "encoding the plan")
+	}
+
+	dryRun.Print(w)
+
+	return nil
+}
+
+func (plan *Plan) Message(message Message) error {
+	plan.Messages = append(plan.Messages, newJSONLRecord(message, time.Now()))
+	return nil
+}
+
+func (plan *Plan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Dry run, nothing was written or sent\n\n")
+
+	fmt.Fprintf(w, "%s:\n", pluralize(len(plan.Mutations), "database change"))
+
+	for _, mutation := range plan.Mutations {
+		fmt.Fprintf(w, "  %s\n", mutation.Statement)
+
+		args := []string{}
+
+		for i, arg := range mutation.Args {
+			args = append(args, fmt.Sprintf("$%d=%v", i+1, arg))
+		}
+
+		if len(args) > 0 {
+			fmt.Fprintf(w, "    %s\n", strings.Join(args, " "))
+		}
+
+		fmt.Fprintf(w, "    %s\n", pluralize(int(mutation.Rows), "row"))
+	}
+
+	fmt.Fprintf(w, "\n%s:\n", pluralize(len(plan.Messages), "message"))
+
+	for _, message := range plan.Messages {
+		channel := message.Channel
+		if channel == "" {
+			channel = "(default)"
+		}
+
+		fmt.Fprintf(w, "  %s %s %s\n", channel, message.Emoji, message.Text)
+	}
+}
+
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// planningDB records every change made through it. Reads go straight to the transaction.
+type planningDB struct {
+	*sqlx.Tx
+	Plan *Plan
+}
+
+func (db planningDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	result, err := db.Tx.Exec(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	}
+
+	db.record(query, args, rows)
+
+	return result, nil
+}
+
+func (db planningDB) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	bound, args, err := db.BindNamed(query, arg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Exec(bound, args...)
+}
+
+// Queryx is for changes that return something, like an INSERT with RETURNING, as well as reads
+func (db planningDB) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	db.plan(query, args)
+
+	return db.Tx.Queryx(query, args...)
+}
+
+func (db planningDB) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	db.plan(query, args)
+
+	return db.Tx.QueryRowx(query, args...)
+}
+
+func (db planningDB) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
+	bound, args, err := db.BindNamed(query, arg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Queryx(bound, args...)
+}
+
+// Get and Select go through QueryRowx and Queryx, rather than the transaction's own, so changes
+// made with them are planned too
+func (db planningDB) Get(dest interface{}, query string, args ...interface{}) error {
+	return sqlx.Get(db, dest, query, args...)
+}
+
+func (db planningDB) Select(dest interface{}, query string, args ...interface{}) error {
+	return sqlx.Select(db, dest, query, args...)
+}
+
+// plan records a change that's about to be queried. The rows it returns are the caller's to read,
+// so it's made once first in a savepoint that's rolled back, to count the rows it really changes,
+// e.g. none for an INSERT that hits ON CONFLICT DO NOTHING. A change that fails isn't recorded,
+// the query fails the same way for the caller.
+func (db planningDB) plan(query string, args []interface{}) {
+	if isSelect(query) {
+		return
+	}
+
+	if _, err := db.Tx.Exec("SAVEPOINT trail_plan"); err != nil {
+		return
+	}
+
+	result, err := db.Tx.Exec(query, args...)
+
+	_, _ = db.Tx.Exec("ROLLBACK TO SAVEPOINT trail_plan")
+
+	if err != nil {
+		return
+	}
+
+	rows, err := result.RowsAffected()
+
+	if err != nil {
+		return
+	}
+
+	db.record(query, args, rows)
+}
+
+func (db planningDB) record(query string, args []interface{}, rows int64) {
+	values := []interface{}{}
+
+	for _, arg := range args {
+		values = append(values, planValue(arg))
+	}
+
+	db.Plan.Mutations = append(db.Plan.Mutations, PlannedMutation{
+		Statement: strings.Join(strings.Fields(query), " "),
+		Args:      values,
+		Rows:      rows,
+	})
+}
+
+func isSelect(query string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT")
+}
+
+// planValue is an argument as the database sees it, e.g. a NullString is its string or nil
+func planValue(arg interface{}) interface{} {
+	valuer, ok := arg.(driver.Valuer)
+
+	if !ok {
+		return arg
+	}
+
+	value, err := valuer.Value()
+
+	if err != nil {
+		return fmt.Sprintf("<%s>", err)
+	}
+
+	if bytes, ok := value.([]byte); ok {
+		return string(bytes)
+	}
+
+	return value
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestPlanValue(t *testing.T) {
+	at := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		arg      interface{}
+		expected interface{}
+	}{
+		{"U1", "U1"},
+		{sql.NullString{String: "U1", Valid: true}, "U1"},
+		{sql.NullString{}, nil},
+		{pq.NullTime{Time: at, Valid: true}, at},
+		{pq.StringArray{"a", "b"}, `{"a","b"}`},
+	}
+
+	for _, c := range cases {
+		if value := planValue(c.arg); value != c.expected {
+			t.Errorf("expected %#v to plan as %#v, got %#v", c.arg, c.expected, value)
+		}
+	}
+}
+
+func TestPlanPrint(t *testing.T) {
+	plan := &Plan{
+		Mutations: []PlannedMutation{
+			{Statement: "UPDATE users SET status = $1 WHERE id = $2", Args: []interface{}{"on the trail", "U1"}, Rows: 1},
+		},
+	}
+
+	_ = plan.Message(deathMessage())
+
+	out := &bytes.Buffer{}
+	plan.Print(out)
+
+	for _, expected := range []string{
+		"1 database change:",
+		"UPDATE users SET status = $1 WHERE id = $2\n    $1=on the trail $2=U1\n    1 row",
+		"1 message:",
+		"(default) :rip: Zach Taylor died of Dysentery",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the plan to include %q, got\n%s", expected, out.String())
+		}
+	}
+
+	encoded, err := json.Marshal(plan)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := struct {
+		Mutations []PlannedMutation
+		Messages  []map[string]interface{}
+	}{}
+
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Mutations) != 1 || len(decoded.Messages) != 1 || decoded.Messages[0]["kind"] != EventDeath {
+		t.Errorf("unexpected json plan %s", encoded)
+	}
+}
+
+func TestIsSelect(t *testing.T) {
+	if !isSelect("\n\t\tselect * from users") || isSelect("INSERT INTO events (kind) VALUES ($1) RETURNING id") {
+		t.Error("expected only selects to be selects")
+	}
+}
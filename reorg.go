@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// reorgThreshold is how many people have to move between the same two supervisors in one run
+// before it's a reorg instead of a handful of supervisor changes
+var reorgThreshold = 3
+
+// Reorg is a group of employees who all moved from one supervisor to another at the same time
+type Reorg struct {
+	FromID string
+	ToID   string
+	Moved  []*Employee
+}
+
+// detectReorgs groups supervisor changes into reorgs, returning the reorgs and whatever moves were
+// left over
+func detectReorgs(moves []OrgChange, threshold int) ([]Reorg, []OrgChange) {
+	type key struct{ from, to string }
+
+	groups := map[key][]OrgChange{}
+	keys := []key{}
+
+	for _, move := range moves {
+		k := key{move.Before.SupervisorID, move.After.SupervisorID}
+
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+
+		groups[k] = append(groups[k], move)
+	}
+
+	reorgs := []Reorg{}
+	rest := []OrgChange{}
+
+	for _, k := range keys {
+		group := groups[k]
+
+		if threshold <= 0 || len(group) < threshold {
+			rest = append(rest, group...)
+			continue
+		}
+
+		reorg := Reorg{FromID: k.from, ToID: k.to}
+
+		for _, move := range group {
+			reorg.Moved = append(reorg.Moved, move.Before)
+		}
+
+		sort.Slice(reorg.Moved, func(i, j int) bool { return reorg.Moved[i].Name < reorg.Moved[j].Name })
+
+		reorgs = append(reorgs, reorg)
+	}
+
+	return reorgs, rest
+}
+
+func reorganizedSupervisors(reorgs []Reorg) map[string]bool {
+	supervisors := map[string]bool{}
+
+	for _, reorg := range reorgs {
+		supervisors[reorg.FromID] = true
+		supervisors[reorg.ToID] = true
+	}
+
+	return supervisors
+}
+
+// reportsChange is a supervisor's reports count before and after a reorg
+type reportsChange struct {
+	From int
+	To   int
+}
+
+// reorgReportsChanges finds the supervisors involved in reorgs whose reports count changed
+func reorgReportsChanges(reorgs []Reorg, oldLookup map[string]*Employee, new []*Employee) map[string]reportsChange {
+	reorganized := reorganizedSupervisors(reorgs)
+	changes := map[string]reportsChange{}
+
+	for _, newEmployee := range new {
+		if oldEmployee, ok := oldLookup[newEmployee.ID]; ok && reorganized[newEmployee.ID] && newEmployee.ReportsCount != oldEmployee.ReportsCount {
+			changes[newEmployee.ID] = reportsChange{From: oldEmployee.ReportsCount, To: newEmployee.ReportsCount}
+		}
+	}
+
+	return changes
+}
+
+// reorgText describes every reorg, and how the reports count of each supervisor involved changed
+func reorgText(reorgs []Reorg, names map[string]string, changes map[string]reportsChange) string {
+	lines := []string{"The wagon party split at the river!"}
+	supervisors := []string{}
+	seen := map[string]bool{}
+
+	for _, reorg := range reorgs {
+		travelers := []string{}
+
+		for _, employee := range reorg.Moved {
+			travelers = append(travelers, employee.Name)
+		}
+
+		lines = append(lines, fmt.Sprintf("• %d travelers left %s for %s: %s", len(travelers), names[reorg.FromID], names[reorg.ToID], strings.Join(travelers, ", ")))
+
+		for _, id := range []string{reorg.FromID, reorg.ToID} {
+			if _, ok := changes[id]; ok && !seen[id] {
+				seen[id] = true
+				supervisors = append(supervisors, id)
+			}
+		}
+	}
+
+	for _, id := range supervisors {
+		lines = append(lines, fmt.Sprintf("• %s's reports changed from %d to %d", names[id], changes[id].From, changes[id].To))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// announceReorgs posts one message covering every reorg, and moves everyone without announcing
+// them individually
+func announceReorgs(reorgs []Reorg, changes map[string]reportsChange) error {
+	if len(reorgs) == 0 {
+		return nil
+	}
+
+	names := map[string]string{}
+
+	for _, reorg := range reorgs {
+		from, err := supervisorName(reorg.FromID)
+
+		if err != nil {
+			return err
+		}
+
+		to, err := supervisorName(reorg.ToID)
+
+		if err != nil {
+			return err
+		}
+
+		names[reorg.FromID], names[reorg.ToID] = from, to
+	}
+
+	err := announce(&Event{Kind: EventReorg, Text: reorgText(reorgs, names, changes), Emoji: ":ocean:"})
+
+	if err != nil {
+		return errors.Wrap(err, "sending reorg message")
+	}
+
+	for _, reorg := range reorgs {
+		from, to := names[reorg.FromID], names[reorg.ToID]
+
+		for _, employee := range reorg.Moved {
+			// The reorg was the announcement, but it's still a move in each traveler's history
+			text := fmt.Sprintf("%s's supervisor changed from %s to %s", employee.Name, from, to)
+
+			event := employeeEvent(EventSupervisor, employee, ":name_badge:", text).Changed(reorg.FromID, reorg.ToID)
+			event.DeliveredAt = pq.NullTime{Time: time.Now(), Valid: true}
+
+			err := createEvent(event)
+
+			if err != nil {
+				return err
+			}
+
+			employee.SupervisorID = reorg.ToID
+
+			err = employee.Update()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// changeReorganizedReportsCount keeps a new reports count the reorg message already announced, it's
+// still a change in the supervisor's history
+func changeReorganizedReportsCount(employee *Employee, newCount int) error {
+	text := fmt.Sprintf("%s's reports changed from %d to %d", employee.Name, employee.ReportsCount, newCount)
+
+	event := employeeEvent(EventReports, employee, ":name_badge:", text).Changed(strconv.Itoa(employee.ReportsCount), strconv.Itoa(newCount))
+	event.DeliveredAt = pq.NullTime{Time: time.Now(), Valid: true}
+
+	err := createEvent(event)
+
+	if err != nil {
+		return err
+	}
+
+	employee.ReportsCount = newCount
+
+	return employee.Update()
+}
+
+func supervisorName(id string) (string, error) {
+	if id == "" {
+		return "nobody", nil
+	}
+
+	supervisor, err := FindEmployee(id)
+
+	if errors.Cause(err) == sql.ErrNoRows {
+		return "nobody", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return supervisor.Name, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDetectReorgs(t *testing.T) {
+	move := func(id, from, to string) OrgChange {
+		return OrgChange{
+			Kind:   OrgChangeMoved,
+			Before: &Employee{ID: id, Name: id, SupervisorID: from},
+			After:  &Employee{ID: id, Name: id, SupervisorID: to},
+		}
+	}
+
+	moves := []OrgChange{
+		move("c", "boss", "new boss"),
+		move("a", "boss", "new boss"),
+		move("d", "boss", "other boss"),
+		move("b", "boss", "new boss"),
+	}
+
+	reorgs, rest := detectReorgs(moves, 3)
+
+	if len(reorgs) != 1 {
+		t.Fatalf("Expected 1 reorg, got %d\n%#v\n", len(reorgs), reorgs)
+	}
+
+	if reorgs[0].FromID != "boss" || reorgs[0].ToID != "new boss" || len(reorgs[0].Moved) != 3 || reorgs[0].Moved[0].Name != "a" {
+		t.Errorf("Expected a, b and c moving from boss to new boss, got %#v\n", reorgs[0])
+	}
+
+	if len(rest) != 1 || rest[0].After.ID != "d" {
+		t.Errorf("Expected d to be left over, got %#v\n", rest)
+	}
+
+	reorgs, rest = detectReorgs(moves, 0)
+
+	if len(reorgs) != 0 || len(rest) != 4 {
+		t.Errorf("Expected no reorgs when disabled, got %d reorgs and %d moves\n", len(reorgs), len(rest))
+	}
+}
+
+func TestReorgText(t *testing.T) {
+	reorgs := []Reorg{
+		{FromID: "boss", ToID: "new boss", Moved: []*Employee{{Name: "a"}, {Name: "b"}, {Name: "c"}}},
+	}
+
+	oldLookup := map[string]*Employee{
+		"boss":     {ID: "boss", ReportsCount: 5},
+		"new boss": {ID: "new boss", ReportsCount: 1},
+		"a":        {ID: "a"},
+	}
+
+	new := []*Employee{
+		{ID: "boss", ReportsCount: 2},
+		{ID: "new boss", ReportsCount: 4},
+		{ID: "a", ReportsCount: 3},
+	}
+
+	changes := reorgReportsChanges(reorgs, oldLookup, new)
+
+	if _, ok := changes["a"]; ok || len(changes) != 2 {
+		t.Errorf("Expected only the reorganized supervisors' reports counts, got %#v\n", changes)
+	}
+
+	names := map[string]string{"boss": "Boss", "new boss": "New Boss"}
+
+	expected := "The wagon party split at the river!\n" +
+		"• 3 travelers left Boss for New Boss: a, b, c\n" +
+		"• Boss's reports changed from 5 to 2\n" +
+		"• New Boss's reports changed from 1 to 4"
+
+	if text := reorgText(reorgs, names, changes); text != expected {
+		t.Errorf("Expected reorg text:\n%s\ngot:\n%s\n", expected, text)
+	}
+}
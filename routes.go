@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// Route sends events to channels. Every condition that's set has to match, kinds and departments
+// match any of theirs, and guests is whether the event is about a guest.
+type Route struct {
+	Kinds       []string `json:"kinds"`
+	Guests      *bool    `json:"guests"`
+	Departments []string `json:"departments"`
+	Channels    []string `json:"channels"`
+}
+
+// routes decide where events go, events no route matches go to SLACK_CHANNEL_ID, see the --routes
+// flag
+var routes = []Route{}
+
+var eventKinds = []string{
+	EventBirth, EventDeath, EventRename, EventStatus, EventUserTitle, EventNecromance, EventAdmin,
+	EventEmojiAdded, EventEmojiRemoved, EventHire, EventDeparture, EventRehire, EventSupervisor,
+	EventReports, EventTitle, EventDepartment, EventLocation, EventReorg, EventAnniversary,
+	EventLandmark,
+}
+
+func loadRoutes(value string) ([]Route, error) {
+	if value == "" {
+		return []Route{}, nil
+	}
+
+	config := struct {
+		Routes []Route `json:"routes"`
+	}{}
+
+	err := loadConfig(value, &config)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "loading routes")
+	}
+
+	for _, route := range config.Routes {
+		for _, kind := range route.Kinds {
+			if !containsString(eventKinds, kind) {
+				return nil, fmt.Errorf("unknown event kind %s in routes, expected one of %s", kind, strings.Join(eventKinds, ", "))
+			}
+		}
+	}
+
+	return config.Routes, nil
+}
+
+func (route Route) Matches(event *Event) bool {
+	if len(route.Kinds) > 0 && !containsString(route.Kinds, event.Kind) {
+		return false
+	}
+
+	if route.Guests != nil && (event.User == nil || event.User.Guest != *route.Guests) {
+		return false
+	}
+
+	if len(route.Departments) > 0 && (event.Employee == nil || !containsString(route.Departments, event.Employee.Department)) {
+		return false
+	}
+
+	return true
+}
+
+// routeEvent is every channel the routes send an event to. Matching routes without channels
+// silence an event, it's still recorded.
+func routeEvent(routes []Route, event *Event, fallback string) []string {
+	matched := false
+	channels := []string{}
+
+	for _, route := range routes {
+		if !route.Matches(event) {
+			continue
+		}
+
+		matched = true
+
+		for _, channel := range route.Channels {
+			if !containsString(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+	}
+
+	if !matched {
+		return []string{fallback}
+	}
+
+	return channels
+}
+
+// eventChannels routes an event, first looking up the slack user or employee on the other side of
+// the event's link when a route needs them
+func eventChannels(event *Event) ([]string, error) {
+	needsUser, needsEmployee := false, false
+
+	for _, route := range routes {
+		needsUser = needsUser || route.Guests != nil
+		needsEmployee = needsEmployee || len(route.Departments) > 0
+	}
+
+	var err error
+
+	if needsUser && event.User == nil && event.Employee != nil {
+		event.User, err = userForEmployee(event.Employee)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if needsEmployee && event.Employee == nil && event.User != nil {
+		event.Employee, err = employeeForUser(event.User)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return routeEvent(routes, event, slackChannelID), nil
+}
+
+// runRoutesTest shows where an event would go, about a slack user or employee if one is given
+func runRoutesTest(kind, userRef, employeeID string) error {
+	if !containsString(eventKinds, kind) {
+		return fmt.Errorf("unknown event kind %s, expected one of %s", kind, strings.Join(eventKinds, ", "))
+	}
+
+	event := &Event{Kind: kind}
+
+	if userRef != "" {
+		user, err := findUser(userRef)
+
+		if err != nil {
+			return err
+		}
+
+		event.User = user
+	}
+
+	if employeeID != "" {
+		employee, err := FindEmployee(employeeID)
+
+		if err != nil {
+			return err
+		}
+
+		event.Employee = employee
+	}
+
+	channels, err := eventChannels(event)
+
+	if err != nil {
+		return err
+	}
+
+	if len(channels) == 0 {
+		fmt.Printf("A %s event wouldn't be announced anywhere\n", kind)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "CHANNEL\tDELIVERY")
+
+	for _, channel := range channels {
+		delivery := "immediate"
+		if holdsForDigest(channel, kind) {
+			delivery = fmt.Sprintf("%s digest", digests[channel].Every)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\n", channel, delivery)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouteEvent(t *testing.T) {
+	routes, err := loadRoutes(`{"routes": [
+		{"kinds": ["death"], "channels": ["#trail"]},
+		{"kinds": ["admin"], "channels": ["#security-audit"]},
+		{"kinds": ["emoji_added", "emoji_removed"], "channels": ["#emoji-watch", "#trail"]},
+		{"kinds": ["birth"], "guests": true, "channels": []},
+		{"departments": ["Engineering"], "channels": ["#eng", "#trail"]}
+	]}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guest := &User{ID: "U1", Guest: true}
+	member := &User{ID: "U2"}
+	engineer := &Employee{ID: "1", Department: "Engineering"}
+
+	tests := []struct {
+		name     string
+		event    *Event
+		expected []string
+	}{
+		{"death", &Event{Kind: EventDeath, User: member}, []string{"#trail"}},
+		{"admin", &Event{Kind: EventAdmin, User: member}, []string{"#security-audit"}},
+		{"emoji", &Event{Kind: EventEmojiAdded}, []string{"#emoji-watch", "#trail"}},
+		{"guest birth", &Event{Kind: EventBirth, User: guest}, []string{}},
+		{"member birth", &Event{Kind: EventBirth, User: member}, []string{"C0"}},
+		{"engineer death", &Event{Kind: EventDeath, User: member, Employee: engineer}, []string{"#trail", "#eng"}},
+		{"engineer hire", &Event{Kind: EventHire, Employee: engineer}, []string{"#eng", "#trail"}},
+		{"unrouted", &Event{Kind: EventReorg}, []string{"C0"}},
+	}
+
+	for _, test := range tests {
+		if channels := routeEvent(routes, test.event, "C0"); !reflect.DeepEqual(channels, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, channels)
+		}
+	}
+
+	if channels := routeEvent([]Route{}, &Event{Kind: EventDeath}, "C0"); !reflect.DeepEqual(channels, []string{"C0"}) {
+		t.Errorf("expected everything to go to the default channel without routes, got %v", channels)
+	}
+}
+
+func TestLoadRoutesUnknownKind(t *testing.T) {
+	if _, err := loadRoutes(`{"routes": [{"kinds": ["deaths"], "channels": ["#trail"]}]}`); err == nil {
+		t.Errorf("expected an error for a misspelled event kind")
+	}
+}
@@ -29,6 +29,45 @@ SET default_tablespace = '';
 
 SET default_with_oids = false;
 
+--
+-- Name: anniversaries; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE TABLE public.anniversaries (
+    kind character varying(255) NOT NULL,
+    subject_id text NOT NULL,
+    years integer NOT NULL,
+    celebrated_on date NOT NULL
+);
+
+
+ALTER TABLE public.anniversaries OWNER TO zachtaylor;
+
+--
+-- Name: anniversary_opt_outs; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE TABLE public.anniversary_opt_outs (
+    user_id character varying(255) NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.anniversary_opt_outs OWNER TO zachtaylor;
+
+--
+-- Name: digest_items; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE TABLE public.digest_items (
+    event_id integer NOT NULL,
+    channel character varying(255) NOT NULL,
+    digested_at timestamp with time zone
+);
+
+
+ALTER TABLE public.digest_items OWNER TO zachtaylor;
+
 --
 -- Name: emojis; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
 --
@@ -52,12 +91,121 @@ CREATE TABLE public.employees (
     reports_count integer NOT NULL,
     created_at timestamp without time zone DEFAULT now() NOT NULL,
     deleted boolean DEFAULT false,
-    deleted_at timestamp without time zone
+    deleted_at timestamp without time zone,
+    announced_at timestamp without time zone,
+    email character varying(255) DEFAULT ''::character varying NOT NULL,
+    title text DEFAULT ''::text NOT NULL,
+    department text DEFAULT ''::text NOT NULL,
+    location text DEFAULT ''::text NOT NULL,
+    hired_at date,
+    photo_url text DEFAULT ''::text NOT NULL
 );
 
 
 ALTER TABLE public.employees OWNER TO zachtaylor;
 
+--
+-- Name: employee_versions; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE TABLE public.employee_versions (
+    employee_id text NOT NULL,
+    name text NOT NULL,
+    supervisor_id text,
+    reports_count integer NOT NULL,
+    deleted boolean DEFAULT false NOT NULL,
+    valid_from timestamp with time zone NOT NULL,
+    valid_to timestamp with time zone,
+    title text DEFAULT ''::text NOT NULL,
+    department text DEFAULT ''::text NOT NULL,
+    location text DEFAULT ''::text NOT NULL
+);
+
+
+ALTER TABLE public.employee_versions OWNER TO zachtaylor;
+
+--
+-- Name: event_deliveries; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE TABLE public.event_deliveries (
+    event_id integer NOT NULL,
+    channel text NOT NULL,
+    delivered_at timestamp with time zone NOT NULL
+);
+
+
+ALTER TABLE public.event_deliveries OWNER TO zachtaylor;
+
+--
+-- Name: events; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE TABLE public.events (
+    id integer NOT NULL,
+    kind character varying(255) NOT NULL,
+    user_id character varying(255),
+    employee_id text,
+    text text NOT NULL,
+    emoji character varying(255) NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    old_value text DEFAULT ''::text NOT NULL,
+    new_value text DEFAULT ''::text NOT NULL,
+    delivered_at timestamp with time zone
+);
+
+
+ALTER TABLE public.events OWNER TO zachtaylor;
+
+--
+-- Name: events_id_seq; Type: SEQUENCE; Schema: public; Owner: zachtaylor
+--
+
+CREATE SEQUENCE public.events_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.events_id_seq OWNER TO zachtaylor;
+
+--
+-- Name: events_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: zachtaylor
+--
+
+ALTER SEQUENCE public.events_id_seq OWNED BY public.events.id;
+
+
+--
+-- Name: image_cache; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE TABLE public.image_cache (
+    key text NOT NULL,
+    urls text[] NOT NULL,
+    cached_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.image_cache OWNER TO zachtaylor;
+
+--
+-- Name: links; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE TABLE public.links (
+    user_id character varying(255) NOT NULL,
+    employee_id text NOT NULL,
+    source character varying(255) NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.links OWNER TO zachtaylor;
+
 --
 -- Name: schema_migrations; Type: TABLE; Schema: public; Owner: zachtaylor; Tablespace: 
 --
@@ -84,12 +232,65 @@ CREATE TABLE public.users (
     deleted_at timestamp with time zone,
     display_name character varying(255) DEFAULT ''::character varying NOT NULL,
     status character varying(255) DEFAULT ''::character varying NOT NULL,
-    title character varying(255) DEFAULT ''::character varying NOT NULL
+    title character varying(255) DEFAULT ''::character varying NOT NULL,
+    email character varying(255) DEFAULT ''::character varying NOT NULL,
+    created_at_source character varying(255) DEFAULT 'unknown'::character varying NOT NULL,
+    created_at_confidence real DEFAULT 0 NOT NULL,
+    admin boolean,
+    guest boolean DEFAULT false NOT NULL,
+    bot boolean DEFAULT false NOT NULL
 );
 
 
 ALTER TABLE public.users OWNER TO zachtaylor;
 
+--
+-- Name: events id; Type: DEFAULT; Schema: public; Owner: zachtaylor
+--
+
+ALTER TABLE ONLY public.events ALTER COLUMN id SET DEFAULT nextval('public.events_id_seq'::regclass);
+
+
+--
+-- Name: unique_kind_subject_id_years_on_anniversaries; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+ALTER TABLE ONLY public.anniversaries
+    ADD CONSTRAINT unique_kind_subject_id_years_on_anniversaries UNIQUE (kind, subject_id, years);
+
+
+--
+-- Name: unique_event_id_channel_on_digest_items; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+ALTER TABLE ONLY public.digest_items
+    ADD CONSTRAINT unique_event_id_channel_on_digest_items UNIQUE (event_id, channel);
+
+
+--
+-- Name: unique_event_id_channel_on_event_deliveries; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+ALTER TABLE ONLY public.event_deliveries
+    ADD CONSTRAINT unique_event_id_channel_on_event_deliveries UNIQUE (event_id, channel);
+
+
+--
+-- Name: unique_user_id_on_anniversary_opt_outs; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+ALTER TABLE ONLY public.anniversary_opt_outs
+    ADD CONSTRAINT unique_user_id_on_anniversary_opt_outs UNIQUE (user_id);
+
+
+--
+-- Name: events_pkey; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+ALTER TABLE ONLY public.events
+    ADD CONSTRAINT events_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: employees_pkey; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
 --
@@ -98,6 +299,14 @@ ALTER TABLE ONLY public.employees
     ADD CONSTRAINT employees_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: unique_key_on_image_cache; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+ALTER TABLE ONLY public.image_cache
+    ADD CONSTRAINT unique_key_on_image_cache UNIQUE (key);
+
+
 --
 -- Name: schema_migrations_pkey; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
 --
@@ -114,6 +323,14 @@ ALTER TABLE ONLY public.users
     ADD CONSTRAINT unique_id_on_users UNIQUE (id);
 
 
+--
+-- Name: unique_user_id_on_links; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+ALTER TABLE ONLY public.links
+    ADD CONSTRAINT unique_user_id_on_links UNIQUE (user_id);
+
+
 --
 -- Name: unique_name_on_emojis; Type: CONSTRAINT; Schema: public; Owner: zachtaylor; Tablespace: 
 --
@@ -122,6 +339,41 @@ ALTER TABLE ONLY public.emojis
     ADD CONSTRAINT unique_name_on_emojis UNIQUE (name);
 
 
+--
+-- Name: index_digest_items_on_channel_and_digested_at; Type: INDEX; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE INDEX index_digest_items_on_channel_and_digested_at ON public.digest_items USING btree (channel, digested_at);
+
+
+--
+-- Name: index_employee_versions_on_employee_id; Type: INDEX; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE INDEX index_employee_versions_on_employee_id ON public.employee_versions USING btree (employee_id);
+
+
+--
+-- Name: index_employee_versions_on_valid_from_and_valid_to; Type: INDEX; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE INDEX index_employee_versions_on_valid_from_and_valid_to ON public.employee_versions USING btree (valid_from, valid_to);
+
+
+--
+-- Name: index_events_on_employee_id; Type: INDEX; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE INDEX index_events_on_employee_id ON public.events USING btree (employee_id);
+
+
+--
+-- Name: index_events_on_user_id; Type: INDEX; Schema: public; Owner: zachtaylor; Tablespace: 
+--
+
+CREATE INDEX index_events_on_user_id ON public.events USING btree (user_id);
+
+
 --
 -- Name: SCHEMA public; Type: ACL; Schema: -; Owner: zachtaylor
 --
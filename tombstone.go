@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // avatars can be any of these
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tombstones turns on rendering tombstones for death announcements, they're only uploaded when
+// messaging slack
+var tombstones bool
+
+// Tombstones are drawn at the apple II's resolution, and scaled up so slack doesn't shrink them
+const (
+	tombstoneWidth  = 280
+	tombstoneHeight = 192
+	tombstoneScale  = 2
+	avatarSize      = 40
+)
+
+// The apple II hi-res palette, what the trail looked like in 1985
+var tombstonePalette = color.Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xff},
+	color.RGBA{0xff, 0xff, 0xff, 0xff},
+	color.RGBA{0x14, 0xf5, 0x3c, 0xff},
+	color.RGBA{0xff, 0x44, 0xfd, 0xff},
+	color.RGBA{0xff, 0x6a, 0x3c, 0xff},
+	color.RGBA{0x14, 0xcf, 0xfd, 0xff},
+}
+
+const (
+	paletteBlack = iota
+	paletteWhite
+	paletteGreen
+)
+
+// glyphs is a 5x7 pixel font, each row is a bitmask with the leftmost pixel as bit 4
+var glyphs = map[rune][7]uint8{
+	'A':  {0x0e, 0x11, 0x11, 0x11, 0x1f, 0x11, 0x11},
+	'B':  {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C':  {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D':  {0x1c, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1c},
+	'E':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G':  {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H':  {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I':  {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M':  {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P':  {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q':  {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R':  {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S':  {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T':  {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X':  {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+	'Z':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'0':  {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1':  {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3':  {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4':  {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5':  {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6':  {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9':  {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	' ':  {},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08},
+	'\'': {0x0c, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'-':  {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'?':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	':':  {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'&':  {0x0c, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0d},
+}
+
+const (
+	glyphWidth  = 6 // including a pixel of spacing
+	glyphHeight = 7
+	lineHeight  = 10
+)
+
+func glyph(r rune) [7]uint8 {
+	if g, ok := glyphs[r]; ok {
+		return g
+	}
+	if g, ok := glyphs[[]rune(strings.ToUpper(string(r)))[0]]; ok {
+		return g
+	}
+	return glyphs['?']
+}
+
+func drawText(img *image.Paletted, text string, x, y int, colorIndex uint8) {
+	for _, r := range text {
+		g := glyph(r)
+
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < 5; col++ {
+				if g[row]&(1<<uint(4-col)) != 0 {
+					img.SetColorIndex(x+col, y+row, colorIndex)
+				}
+			}
+		}
+
+		x += glyphWidth
+	}
+}
+
+// wrapText breaks text into lines of at most width characters, on spaces when it can
+func wrapText(text string, width int) []string {
+	lines := []string{}
+	line := ""
+
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+
+			lines = append(lines, string([]rune(word)[:width]))
+			word = string([]rune(word)[width:])
+		}
+
+		if line == "" {
+			line = word
+		} else if len([]rune(line))+1+len([]rune(word)) <= width {
+			line += " " + word
+		} else {
+			lines = append(lines, line)
+			line = word
+		}
+	}
+
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// trailAge is how long someone lasted, in the biggest unit that makes sense
+func trailAge(d time.Duration) string {
+	days := int(d.Hours() / 24)
+
+	unit := func(n int, name string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", name)
+		}
+		return fmt.Sprintf("%d %ss", n, name)
+	}
+
+	switch {
+	case days >= 365:
+		return unit(days/365, "year")
+	case days >= 30:
+		return unit(days/30, "month")
+	default:
+		return unit(days, "day")
+	}
+}
+
+// The stone is a rectangle with a half circle on top
+const (
+	stoneLeft    = 70
+	stoneRight   = 210
+	stoneBottom  = 170
+	stoneRadius  = (stoneRight - stoneLeft) / 2
+	stoneCenterX = stoneLeft + stoneRadius
+	stoneCenterY = 90
+	grassTop     = 150
+)
+
+func onStone(x, y int) bool {
+	if y >= stoneCenterY {
+		return x >= stoneLeft && x < stoneRight && y < stoneBottom
+	}
+
+	dx, dy := x-stoneCenterX, y-stoneCenterY
+
+	return dx*dx+dy*dy <= stoneRadius*stoneRadius
+}
+
+// renderTombstone draws an epitaph on a tombstone, with the avatar dithered to the palette above it
+// if there is one
+func renderTombstone(epitaph []string, avatar image.Image) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, tombstoneWidth, tombstoneHeight), tombstonePalette)
+
+	for y := 0; y < tombstoneHeight; y++ {
+		for x := 0; x < tombstoneWidth; x++ {
+			switch {
+			case onStone(x, y):
+				img.SetColorIndex(x, y, paletteWhite)
+			case y >= grassTop:
+				img.SetColorIndex(x, y, paletteGreen)
+			}
+		}
+	}
+
+	if avatar != nil {
+		at := image.Rect(stoneCenterX-avatarSize/2, 34, stoneCenterX+avatarSize/2, 34+avatarSize)
+		draw.FloydSteinberg.Draw(img, at, scaleImage(avatar, avatarSize, avatarSize), image.Point{})
+	}
+
+	maxChars := (stoneRight - stoneLeft - 8) / glyphWidth
+	y := 82
+
+	for _, text := range epitaph {
+		lines := wrapText(text, maxChars)
+
+		// Blank lines space the epitaph out
+		if len(lines) == 0 {
+			lines = []string{""}
+		}
+
+		for _, line := range lines {
+			if y+glyphHeight > stoneBottom-4 {
+				return img
+			}
+
+			x := stoneCenterX - (len([]rune(line))*glyphWidth-1)/2
+			drawText(img, line, x, y, paletteBlack)
+			y += lineHeight
+		}
+	}
+
+	return img
+}
+
+// scaleImage resizes with nearest neighbour sampling, which is all pixel art needs
+func scaleImage(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dst.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+
+	return dst
+}
+
+func upscale(src *image.Paletted, n int) *image.Paletted {
+	bounds := src.Bounds()
+	dst := image.NewPaletted(image.Rect(0, 0, bounds.Dx()*n, bounds.Dy()*n), src.Palette)
+
+	for y := 0; y < dst.Bounds().Dy(); y++ {
+		for x := 0; x < dst.Bounds().Dx(); x++ {
+			dst.SetColorIndex(x, y, src.ColorIndexAt(bounds.Min.X+x/n, bounds.Min.Y+y/n))
+		}
+	}
+
+	return dst
+}
+
+func fetchImage(url string) (image.Image, error) {
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Get(url)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching image %s", url)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("fetching image %s, expected 200 status but got %d", url, resp.StatusCode)
+	}
+
+	img, _, err := image.Decode(resp.Body)
+
+	return img, errors.Wrapf(err, "decoding image %s", url)
+}
+
+// Tombstone renders a user's tombstone as a png. A missing avatar leaves the stone blank rather than
+// failing the burial.
+func (user *User) Tombstone(w io.Writer, fate string) error {
+	var avatar image.Image
+
+	if user.Avatar != "" {
+		var err error
+		avatar, err = fetchImage(user.Avatar)
+
+		if err != nil && verbose {
+			fmt.Printf("Drawing %s's tombstone without their avatar: %s\n", user.SomeName(), err)
+		}
+	}
+
+	epitaph := []string{
+		"Here lies",
+		user.SomeName(),
+		"",
+		fmt.Sprintf("%s on the trail", trailAge(user.Age())),
+		capitalize(fate),
+	}
+
+	err := png.Encode(w, upscale(renderTombstone(epitaph, avatar), tombstoneScale))
+
+	return errors.Wrap(err, "encoding tombstone")
+}
+
+// uploadTombstone puts a user's tombstone in slack and returns a url attachments can show it with
+func uploadTombstone(user *User, fate string) (string, error) {
+	buffer := bytes.Buffer{}
+
+	err := user.Tombstone(&buffer, fate)
+
+	if err != nil {
+		return "", err
+	}
+
+	return uploadImage(&buffer, fmt.Sprintf("tombstone-%s.png", user.ID), fmt.Sprintf("Here lies %s", user.SomeName()))
+}
+
+func runRenderTombstone(userRef, fate, out string) error {
+	user, err := findUser(userRef)
+
+	if err != nil {
+		return err
+	}
+
+	if fate == "" {
+		fate = user.Fate()
+	}
+
+	file, err := os.Create(out)
+
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", out)
+	}
+
+	defer file.Close()
+
+	err = user.Tombstone(file, fate)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Drew %s's tombstone to %s\n", user.SomeName(), out)
+
+	return file.Close()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"", []string{}},
+		{"Died of Cholera", []string{"Died of", "Cholera"}},
+		{"Here lies", []string{"Here lies"}},
+		{"Wolfeschlegelsteinhausen", []string{"Wolfeschl", "egelstein", "hausen"}},
+	}
+
+	for _, test := range tests {
+		if lines := wrapText(test.text, 9); !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("wrapping %q, expected %q, got %q", test.text, test.expected, lines)
+		}
+	}
+}
+
+func TestTrailAge(t *testing.T) {
+	day := 24 * time.Hour
+
+	tests := map[time.Duration]string{
+		0:          "0 days",
+		day:        "1 day",
+		45 * day:   "1 month",
+		800 * day:  "2 years",
+		3650 * day: "10 years",
+	}
+
+	for d, expected := range tests {
+		if age := trailAge(d); age != expected {
+			t.Errorf("expected %s, got %s", expected, age)
+		}
+	}
+}
+
+func TestRenderTombstone(t *testing.T) {
+	avatar := image.NewRGBA(image.Rect(0, 0, 100, 100))
+
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			avatar.Set(x, y, color.RGBA{uint8(x * 2), 80, uint8(y * 2), 0xff})
+		}
+	}
+
+	blank := renderTombstone(nil, nil)
+	img := renderTombstone([]string{"Here lies", "Zach Taylor"}, avatar)
+
+	if img.Bounds().Dx() != tombstoneWidth || img.Bounds().Dy() != tombstoneHeight {
+		t.Fatalf("expected a %dx%d tombstone, got %s", tombstoneWidth, tombstoneHeight, img.Bounds())
+	}
+
+	if bytes.Equal(blank.Pix, img.Pix) {
+		t.Errorf("expected the epitaph and avatar to be drawn")
+	}
+
+	for _, i := range img.Pix {
+		if int(i) >= len(tombstonePalette) {
+			t.Fatalf("expected only palette colors, got index %d", i)
+		}
+	}
+
+	if i := img.ColorIndexAt(stoneCenterX, stoneBottom-2); i != paletteWhite {
+		t.Errorf("expected the stone to be white, got %d", i)
+	}
+}
+
+func TestUserTombstone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/avatar.png" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_ = png.Encode(w, image.NewGray(image.Rect(0, 0, 48, 48)))
+	}))
+	defer server.Close()
+
+	for _, avatar := range []string{server.URL + "/avatar.png", server.URL + "/missing.png"} {
+		user := User{ID: "U1", Name: "zach", Avatar: avatar, CreatedAt: time.Now().Add(-48 * time.Hour)}
+		buffer := bytes.Buffer{}
+
+		err := user.Tombstone(&buffer, "died of Dysentery")
+
+		if err != nil {
+			t.Fatalf("drawing tombstone with avatar %s: %s", avatar, err)
+		}
+
+		img, err := png.Decode(&buffer)
+
+		if err != nil {
+			t.Fatalf("decoding tombstone: %s", err)
+		}
+
+		if width := img.Bounds().Dx(); width != tombstoneWidth*tombstoneScale {
+			t.Errorf("expected a scaled up tombstone, got width %d", width)
+		}
+	}
+}
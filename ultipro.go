@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
 	"golang.org/x/net/publicsuffix"
 )
 
@@ -21,6 +27,8 @@ type EmployeeWithReports struct {
 	SupervisorID      string                `json:"supervisorId"`
 	DirectReportCount int                   `json:"directReportCount"`
 	Reports           []EmployeeWithReports `json:"children"`
+	ImageURL          string                `json:"imageUrl"`
+	ThumbnailFields   []ThumbnailField      `json:"thumbnailFields"`
 	// Supervisors                       []interface{}       `json:"supervisors"`
 	// Collapsed                         bool                `json:"collapsed"`
 	// CompanyID                         string              `json:"companyId"`
@@ -28,7 +36,6 @@ type EmployeeWithReports struct {
 	// Focused                           bool                `json:"focused"`
 	// FullJobDescription                bool                `json:"fullJobDescription"`
 	// IDandCompany                      string              `json:"id"`
-	// ImageURL                          string              `json:"imageUrl"`
 	// IndirectReportCount               int                 `json:"indirectReportCount"`
 	// IndirectReportCountVisible        bool                `json:"indirectReportCountVisible"`
 	// IndirectReportCSSStyle            string              `json:"indirectReportCssStyle"`
@@ -38,103 +45,303 @@ type EmployeeWithReports struct {
 	// Selected                          bool                `json:"selected"`
 	// SupervisorCount                   int                 `json:"supervisorCount"`
 	// SupervisorInfo                    interface{}         `json:"supervisorInfo"`
-	// ThumbnailFields                   []struct {
-	// 	BaseID         string      `json:"baseId"`
-	// 	DropdownValues interface{} `json:"dropdownValues"`
-	// 	Section        interface{} `json:"section"`
-	// 	TemplateName   string      `json:"templateName"`
-	//	Title          string      `json:"title"`
-	// 	ValueSelected  interface{} `json:"valueSelected"`
-	// 	Values         []string    `json:"values"`
-	// } `json:"thumbnailFields"`
 	// Top int `json:"top"`
 }
 
+// ThumbnailField is one of the labelled values shown on an org chart card, like job title
+type ThumbnailField struct {
+	BaseID       string   `json:"baseId"`
+	TemplateName string   `json:"templateName"`
+	Title        string   `json:"title"`
+	Values       []string `json:"values"`
+	// DropdownValues interface{} `json:"dropdownValues"`
+	// Section        interface{} `json:"section"`
+	// ValueSelected  interface{} `json:"valueSelected"`
+}
+
+// field finds the first thumbnail field whose title mentions any of the labels
+func (person *EmployeeWithReports) field(labels ...string) string {
+	for _, field := range person.ThumbnailFields {
+		for _, label := range labels {
+			if strings.Contains(strings.ToLower(field.Title), label) && len(field.Values) > 0 {
+				return strings.TrimSpace(field.Values[0])
+			}
+		}
+	}
+
+	return ""
+}
+
+func (person *EmployeeWithReports) Employee() *Employee {
+	employee := &Employee{
+		ID:           person.ID,
+		Name:         person.Name,
+		ReportsCount: person.DirectReportCount,
+		SupervisorID: person.SupervisorID,
+		Email:        person.field("email", "e-mail"),
+		Title:        person.field("job", "title"),
+		Department:   person.field("department"),
+		Location:     person.field("location"),
+		HiredAt:      parseHireDate(person.field("hire")),
+		PhotoURL:     person.ImageURL,
+	}
+
+	if strings.HasPrefix(employee.PhotoURL, "/") {
+		employee.PhotoURL = ultiproURL + employee.PhotoURL
+	}
+
+	return employee
+}
+
+// Tuning for crawling the org chart, see the employees command flags
+var (
+	ultiproConcurrency = 8
+	ultiproTimeout     = 15 * time.Second
+	ultiproRetries     = 3
+	// ultiproBackoff is how long to wait before the first retry, doubling each retry after
+	ultiproBackoff = 500 * time.Millisecond
+)
+
 func GetAllEmployees() ([]*Employee, error) {
-	browser, err := Login()
+	session, err := newUltiproSession()
 
 	if err != nil {
 		return nil, err
 	}
 
+	ctx := context.Background()
+
 	// Adam's ID
-	root, err := GetDirectReports(browser, "BY4GHG02C0K0")
+	root, err := getDirectReportsWithRetry(ctx, session, "BY4GHG02C0K0")
 
 	if err != nil {
 		return nil, err
 	}
 
-	return GetAllReports(browser, root, []*Employee{}, []int{})
+	return GetAllReports(ctx, session, root, ultiproConcurrency)
 }
 
-func GetAllReports(browser *http.Client, person *EmployeeWithReports, people []*Employee, indexes []int) ([]*Employee, error) {
-	if verbose {
-		fmt.Println(person.Name, person.DirectReportCount, indexes, len(people))
+type crawlJob struct {
+	person  EmployeeWithReports
+	indexes []int
+}
+
+// orgCrawler walks the org chart with a fixed number of workers, each fetching one manager's
+// reports at a time and queueing up the reports who are managers themselves
+type orgCrawler struct {
+	session *ultiproSession
+	jobs    chan crawlJob
+	pending sync.WaitGroup
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	people  []*Employee
+	err     error
+	queued  int
+	crawled int
+}
+
+func GetAllReports(ctx context.Context, session *ultiproSession, root *EmployeeWithReports, concurrency int) ([]*Employee, error) {
+	if concurrency < 1 {
+		concurrency = 1
 	}
 
-	people = append(people, &Employee{
-		ID:           person.ID,
-		Name:         person.Name,
-		ReportsCount: person.DirectReportCount,
-		SupervisorID: person.SupervisorID},
-	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	crawler := &orgCrawler{
+		session: session,
+		jobs:    make(chan crawlJob),
+		cancel:  cancel,
+	}
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for job := range crawler.jobs {
+				crawler.crawl(ctx, job)
+				crawler.pending.Done()
+			}
+		}()
+	}
+
+	crawler.enqueue([]crawlJob{{person: *root, indexes: []int{}}})
+
+	crawler.pending.Wait()
+	close(crawler.jobs)
+	workers.Wait()
+
+	if crawler.err != nil {
+		return nil, crawler.err
+	}
+
+	sort.Slice(crawler.people, func(i, j int) bool { return crawler.people[i].ID < crawler.people[j].ID })
+
+	return crawler.people, nil
+}
+
+// enqueue hands jobs to the workers without blocking the worker that found them
+func (crawler *orgCrawler) enqueue(jobs []crawlJob) {
+	crawler.mu.Lock()
+	crawler.queued += len(jobs)
+	crawler.mu.Unlock()
+
+	crawler.pending.Add(len(jobs))
+
+	go func() {
+		for _, job := range jobs {
+			crawler.jobs <- job
+		}
+	}()
+}
+
+func (crawler *orgCrawler) fail(err error) {
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+
+	if crawler.err == nil {
+		crawler.err = err
+		crawler.cancel()
+	}
+}
+
+func (crawler *orgCrawler) crawl(ctx context.Context, job crawlJob) {
+	if ctx.Err() != nil {
+		// Something already failed, just drain the queue
+		return
+	}
+
+	person := job.person
+
+	crawler.mu.Lock()
+	crawler.people = append(crawler.people, person.Employee())
+	crawler.crawled++
+	if verbose {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s %d %v\n", crawler.crawled, crawler.queued, person.Name, person.DirectReportCount, job.indexes)
+	}
+	crawler.mu.Unlock()
 
 	if person.DirectReportCount == 0 {
-		return people, nil
+		return
 	}
 
-	root, err := GetDirectReports(browser, person.ID)
+	root, err := getDirectReportsWithRetry(ctx, crawler.session, person.ID)
+
 	if err != nil {
-		return nil, err
+		crawler.fail(errors.Wrapf(err, "getting reports of %s(%s)", person.Name, person.ID))
+		return
 	}
 
 	// Listing a users reports still returns the root
 	// So we keep track of index (where we are in the tree) and go back there
-	for _, n := range indexes {
+	for _, n := range job.indexes {
+		if n >= len(root.Reports) {
+			crawler.fail(fmt.Errorf("processing %s(%s), expected to find self at %v indexes but the tree ended at %s(%s)", person.Name, person.ID, job.indexes, root.Name, root.ID))
+			return
+		}
+
 		root = &root.Reports[n]
 	}
 
 	if root.ID != person.ID {
-		return nil, fmt.Errorf("processing %s(%s), expected to find self at %v indexes but found %s(%s) instead", person.Name, person.ID, indexes, root.Name, root.ID)
+		crawler.fail(fmt.Errorf("processing %s(%s), expected to find self at %v indexes but found %s(%s) instead", person.Name, person.ID, job.indexes, root.Name, root.ID))
+		return
+	}
+
+	jobs := []crawlJob{}
+
+	for i, report := range root.Reports {
+		indexes := make([]int, len(job.indexes), len(job.indexes)+1)
+		copy(indexes, job.indexes)
+
+		jobs = append(jobs, crawlJob{person: report, indexes: append(indexes, i)})
 	}
 
-	for i, p := range root.Reports {
-		people, err = GetAllReports(browser, &p, people, append(indexes, i))
+	crawler.enqueue(jobs)
+}
+
+// transientError is a failure worth trying again, like a timeout or a 5xx
+type transientError struct {
+	error
+}
 
-		if err != nil {
-			return nil, err
+func getDirectReportsWithRetry(ctx context.Context, session *ultiproSession, employeeID string) (*EmployeeWithReports, error) {
+	var err error
+
+	for attempt := 0; attempt <= ultiproRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * ultiproBackoff
+
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Retrying reports of %s in %s after: %s\n", employeeID, backoff, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		requestCtx, cancel := context.WithTimeout(ctx, ultiproTimeout)
+		var reports *EmployeeWithReports
+		reports, err = session.GetDirectReports(requestCtx, employeeID)
+		cancel()
+
+		if _, transient := err.(transientError); !transient || ctx.Err() != nil {
+			return reports, err
 		}
 	}
 
-	return people, nil
+	return nil, errors.Wrapf(err, "giving up after %d retries", ultiproRetries)
 }
 
+// ultiproURL is the UltiPro site to scrape, overridable for testing against a stand in
+var ultiproURL = "https://nw11.ultipro.com"
+
+// Things that can go wrong logging in to or scraping UltiPro, check for them with errors.Cause
+var (
+	ErrBadCredentials = errors.New("ultipro rejected the username or password")
+	ErrMFARequired    = errors.New("ultipro wants multi factor authentication")
+	ErrSiteChanged    = errors.New("ultipro doesn't look like it used to, the scraper needs updating")
+	ErrSessionExpired = errors.New("ultipro session expired")
+)
+
 func Login() (*http.Client, error) {
 	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.Wrap(err, "creating cookie jar")
 	}
 
 	browser := &http.Client{
 		Jar: jar,
 	}
 
-	resp, err := browser.Get("https://nw11.ultipro.com/Login.aspx")
+	resp, err := browser.Get(ultiproURL + "/Login.aspx")
 
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "getting login page")
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		log.Fatalf("status code error: %d %s", resp.StatusCode, resp.Status)
+		return nil, fmt.Errorf("getting login page, expected 200 status but got %d %s", resp.StatusCode, resp.Status)
 	}
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "parsing login page")
+	}
+
+	if doc.Find(`input[name="ctl00$Content$Login1$UserName"]`).Length() == 0 {
+		return nil, errors.Wrap(ErrSiteChanged, "login page has no username field")
 	}
 
 	tokens := map[string]string{}
@@ -146,10 +353,6 @@ func Login() (*http.Client, error) {
 		tokens[id] = value
 	})
 
-	if err != nil {
-		return nil, err
-	}
-
 	form := url.Values{}
 	for key, value := range tokens {
 		form.Add(key, value)
@@ -161,58 +364,182 @@ func Login() (*http.Client, error) {
 
 	data := form.Encode()
 
-	req, err := http.NewRequest("POST", "https://nw11.ultipro.com/Login.aspx", strings.NewReader(data))
-	// req, err := http.NewRequest("POST", "https://nw11.ultipro.com/Login.aspx", nil)
+	req, err := http.NewRequest("POST", ultiproURL+"/Login.aspx", strings.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	_, err = browser.Do(req)
+	resp, err = browser.Do(req)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "posting login form")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("posting login form, expected 200 status but got %d %s", resp.StatusCode, resp.Status)
+	}
+
+	doc, err = goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing login response")
+	}
+
+	return browser, checkLogin(resp.Request.URL, doc)
+}
+
+var mfaPattern = regexp.MustCompile(`(?i)multi.?factor|two.?factor|verification code|\bmfa\b`)
+
+// checkLogin works out whether posting the login form worked from where we ended up. A good login
+// redirects away from the login page, a bad one shows the login page again with a failure message.
+func checkLogin(landed *url.URL, doc *goquery.Document) error {
+	if mfaPattern.MatchString(landed.Path) {
+		return ErrMFARequired
+	}
+
+	if !strings.Contains(strings.ToLower(landed.Path), "login.aspx") {
+		return nil
+	}
+
+	if mfaPattern.MatchString(doc.Find("form").Text()) {
+		return ErrMFARequired
+	}
+
+	if failure := strings.TrimSpace(doc.Find(`[id$="FailureText"]`).Text()); failure != "" {
+		return errors.Wrap(ErrBadCredentials, failure)
+	}
+
+	if doc.Find(`input[name="ctl00$Content$Login1$UserName"]`).Length() > 0 {
+		return ErrBadCredentials
+	}
+
+	return errors.Wrap(ErrSiteChanged, "login didn't redirect anywhere we recognize")
+}
+
+// ultiproSession is a logged in browser that logs in again when the session expires partway through
+// a crawl
+type ultiproSession struct {
+	mu      sync.Mutex
+	browser *http.Client
+	logins  int
+}
+
+func newUltiproSession() (*ultiproSession, error) {
+	session := &ultiproSession{}
+
+	return session, session.relogin(0)
+}
+
+func (session *ultiproSession) current() (*http.Client, int) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	return session.browser, session.logins
+}
+
+// relogin logs in unless someone else already did since the login that expired
+func (session *ultiproSession) relogin(expired int) error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.logins != expired {
+		return nil
+	}
+
+	if verbose && session.logins > 0 {
+		fmt.Fprintln(os.Stderr, "UltiPro session expired, logging in again...")
+	}
+
+	browser, err := Login()
+
+	if err != nil {
+		return errors.Wrap(err, "logging in to ultipro")
+	}
+
+	session.browser = browser
+	session.logins++
+
+	return nil
+}
+
+func (session *ultiproSession) GetDirectReports(ctx context.Context, employeeID string) (*EmployeeWithReports, error) {
+	browser, login := session.current()
+
+	reports, err := GetDirectReports(ctx, browser, employeeID)
+
+	if errors.Cause(err) != ErrSessionExpired {
+		return reports, err
+	}
+
+	err = session.relogin(login)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return browser, nil
+	browser, _ = session.current()
+
+	return GetDirectReports(ctx, browser, employeeID)
 }
 
-func GetDirectReports(browser *http.Client, employeeID string) (*EmployeeWithReports, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://nw11.ultipro.com/services/OrganizationWebService.svc/OrgHierarchy?coid=ZGFMI&eeid=%s&_=1594948614950", employeeID), nil)
+func GetDirectReports(ctx context.Context, browser *http.Client, employeeID string) (*EmployeeWithReports, error) {
+	query := url.Values{}
+	query.Add("coid", "ZGFMI")
+	query.Add("eeid", employeeID)
+	// Cache buster, like the browser sends
+	query.Add("_", strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10))
+
+	req, err := http.NewRequest("GET", ultiproURL+"/services/OrganizationWebService.svc/OrgHierarchy?"+query.Encode(), nil)
 
 	if err != nil {
 		return nil, err
 	}
 
+	req = req.WithContext(ctx)
 	req.Header.Add("Accept", "application/json, text/javascript, */*")
 
 	resp, err := browser.Do(req)
 
 	if err != nil {
-		return nil, err
+		return nil, transientError{err}
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, transientError{fmt.Errorf("expected 200 status but got %d", resp.StatusCode)}
+	}
+
+	// An expired session either gets turned away or bounced back to the login page
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden ||
+		strings.Contains(strings.ToLower(resp.Request.URL.Path), "login.aspx") {
+		return nil, ErrSessionExpired
 	}
 
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("expected 200 status but got %d", resp.StatusCode)
 	}
 
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, transientError{err}
+	}
+
 	data := struct {
 		OrgChart EmployeeWithReports `json:"orgChart"`
 	}{}
 
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	err = json.Unmarshal(body, &data)
 
 	if err != nil {
-		body, err2 := ioutil.ReadAll(resp.Body)
-
-		if err2 != nil {
-			fmt.Printf("error trying to read body: %s\n", err2)
-			return nil, err
+		if strings.HasPrefix(strings.TrimSpace(string(body)), "<") {
+			return nil, errors.Wrap(ErrSiteChanged, "org chart came back as html instead of json")
 		}
 
-		fmt.Println(string(body))
-
-		return nil, err
+		return nil, errors.Wrap(ErrSiteChanged, err.Error())
 	}
 
 	return &data.OrgChart, nil
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const loginPage = `<html><body><form>
+<input id="__VIEWSTATE" name="__VIEWSTATE" value="state" />
+<span id="ctl00_Content_Login1_FailureText">%s</span>
+<input name="ctl00$Content$Login1$UserName" />
+</form></body></html>`
+
+// fakeUltipro is just enough of UltiPro to log in and ask for an org chart. Sessions expire after
+// expireAfter org chart requests. Call the returned func to shut it down.
+func fakeUltipro(expireAfter int) func() {
+	return (&ultiproFake{expireAfter: expireAfter}).start()
+}
+
+// ultiproFake is the state behind fakeUltipro, for tests that need more than a login
+type ultiproFake struct {
+	expireAfter int
+	// org is the whole org chart, without it every employee is a lone Adam
+	org *EmployeeWithReports
+	// failures are statuses to answer with, in order, before serving an employee's reports
+	failures map[string][]int
+	// hang is an employee whose reports never come back
+	hang string
+
+	mu       sync.Mutex
+	requests int
+	inFlight int
+	// maxInFlight is the most org chart requests being answered at once
+	maxInFlight int
+	// fetched is when each employee's reports were asked for
+	fetched map[string][]time.Time
+}
+
+func (fake *ultiproFake) start() func() {
+	fake.fetched = map[string][]time.Time{}
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/Login.aspx", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && r.FormValue("ctl00$Content$Login1$Password") == "hunter2" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok"})
+			http.Redirect(w, r, "/Dashboard.aspx", http.StatusFound)
+			return
+		}
+
+		failure := ""
+		if r.Method == "POST" {
+			failure = "Your login attempt was not successful."
+		}
+
+		w.Write([]byte(fmtLoginPage(failure)))
+	})
+
+	mux.HandleFunc("/Dashboard.aspx", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>Welcome</html>"))
+	})
+
+	mux.HandleFunc("/services/OrganizationWebService.svc/OrgHierarchy", func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("eeid")
+		cookie, err := r.Cookie("session")
+
+		fake.mu.Lock()
+		if fake.requests == fake.expireAfter {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "", MaxAge: -1})
+			err = http.ErrNoCookie
+		}
+		fake.requests++
+		fake.fetched[id] = append(fake.fetched[id], time.Now())
+		fake.inFlight++
+		if fake.inFlight > fake.maxInFlight {
+			fake.maxInFlight = fake.inFlight
+		}
+		status := 0
+		if len(fake.failures[id]) > 0 {
+			status = fake.failures[id][0]
+			fake.failures[id] = fake.failures[id][1:]
+		}
+		fake.mu.Unlock()
+
+		defer func() {
+			fake.mu.Lock()
+			fake.inFlight--
+			fake.mu.Unlock()
+		}()
+
+		if err != nil || cookie.Value != "ok" {
+			http.Redirect(w, r, "/Login.aspx", http.StatusFound)
+			return
+		}
+
+		if id == fake.hang {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+
+		// Give the other workers a chance to overlap
+		time.Sleep(time.Millisecond)
+
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+
+		chart := &EmployeeWithReports{ID: id, Name: "Adam"}
+
+		if fake.org != nil {
+			chart = orgChartFor(fake.org, id)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"orgChart": chart})
+	})
+
+	server := httptest.NewServer(mux)
+
+	original := ultiproURL
+	ultiproURL = server.URL
+
+	return func() {
+		ultiproURL = original
+		close(release)
+		server.Close()
+	}
+}
+
+// orgChartFor is what UltiPro answers when asked for someone's reports, the chart from the top
+// down with only the people above them and themselves expanded
+func orgChartFor(person *EmployeeWithReports, id string) *EmployeeWithReports {
+	var path func(person *EmployeeWithReports) bool
+
+	path = func(person *EmployeeWithReports) bool {
+		if person.ID == id {
+			return true
+		}
+
+		for i := range person.Reports {
+			if path(&person.Reports[i]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	chart := *person
+	chart.Reports = nil
+
+	if !path(person) {
+		return &chart
+	}
+
+	for i := range person.Reports {
+		chart.Reports = append(chart.Reports, *orgChartFor(&person.Reports[i], id))
+	}
+
+	return &chart
+}
+
+// fakeOrg is an org chart with depth levels of managers under the top, each with width reports
+func fakeOrg(id string, depth, width int) EmployeeWithReports {
+	person := EmployeeWithReports{ID: id, Name: "Person " + id}
+
+	if depth == 0 {
+		return person
+	}
+
+	for i := 0; i < width; i++ {
+		person.Reports = append(person.Reports, fakeOrg(fmt.Sprintf("%s.%d", id, i), depth-1, width))
+	}
+
+	person.DirectReportCount = len(person.Reports)
+
+	return person
+}
+
+func fmtLoginPage(failure string) string {
+	return fmt.Sprintf(loginPage, failure)
+}
+
+// setenv sets an env var for a test, call what it returns to put back whatever was there before
+func setenv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestLoginBadCredentials(t *testing.T) {
+	defer fakeUltipro(-1)()
+	defer setenv("ULTIPRO_PASSWORD", "wrong")()
+
+	_, err := Login()
+
+	if errors.Cause(err) != ErrBadCredentials {
+		t.Errorf("Expected bad credentials, got %v", err)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	defer fakeUltipro(1)()
+	defer setenv("ULTIPRO_PASSWORD", "hunter2")()
+
+	session, err := newUltiproSession()
+
+	if err != nil {
+		t.Fatalf("Error logging in %v", err)
+	}
+
+	for _, id := range []string{"first", "second"} {
+		reports, err := session.GetDirectReports(context.Background(), id)
+
+		if err != nil {
+			t.Fatalf("Error getting reports %v", err)
+		}
+
+		if reports.ID != id {
+			t.Errorf("Expected %s, got %s", id, reports.ID)
+		}
+	}
+
+	if session.logins != 2 {
+		t.Errorf("Expected to log in again after the session expired, logged in %d times", session.logins)
+	}
+}
+
+func TestEmployeeFromOrgChart(t *testing.T) {
+	person := &EmployeeWithReports{
+		ID:   "E1",
+		Name: "Zach Taylor",
+		ThumbnailFields: []ThumbnailField{
+			{Title: "Job Title", Values: []string{"Software Engineer"}},
+			{Title: "Email Address", Values: []string{" zach@example.com "}},
+		},
+	}
+
+	employee := person.Employee()
+
+	if employee.Email != "zach@example.com" || employee.Title != "Software Engineer" {
+		t.Errorf("expected the email and title from the org chart card, got %+v", employee)
+	}
+}
+
+// crawlFakeOrg logs in to the fake and crawls it from the top
+func crawlFakeOrg(fake *ultiproFake, concurrency int) ([]*Employee, error) {
+	session, err := newUltiproSession()
+
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := getDirectReportsWithRetry(context.Background(), session, fake.org.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return GetAllReports(context.Background(), session, root, concurrency)
+}
+
+func TestGetAllReports(t *testing.T) {
+	org := fakeOrg("top", 4, 3)
+	fake := &ultiproFake{
+		expireAfter: -1,
+		org:         &org,
+		failures: map[string][]int{
+			"top.0":     {http.StatusServiceUnavailable},
+			"top.1.2":   {http.StatusTooManyRequests, http.StatusServiceUnavailable},
+			"top.2.0.1": {http.StatusServiceUnavailable},
+		},
+	}
+
+	defer fake.start()()
+	defer setenv("ULTIPRO_PASSWORD", "hunter2")()
+
+	originalBackoff := ultiproBackoff
+	ultiproBackoff = 20 * time.Millisecond
+	defer func() { ultiproBackoff = originalBackoff }()
+
+	employees, err := crawlFakeOrg(fake, 4)
+
+	if err != nil {
+		t.Fatalf("Error crawling the org chart %v", err)
+	}
+
+	// 1 + 3 + 9 + 27 + 81
+	if len(employees) != 121 {
+		t.Errorf("Expected 121 employees, got %d", len(employees))
+	}
+
+	seen := map[string]bool{}
+
+	for _, employee := range employees {
+		if seen[employee.ID] {
+			t.Errorf("Expected to visit %s once, visited again", employee.ID)
+		}
+
+		seen[employee.ID] = true
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	for id, fetched := range fake.fetched {
+		retries := 0
+
+		switch id {
+		case "top.0", "top.2.0.1":
+			retries = 1
+		case "top.1.2":
+			retries = 2
+		}
+
+		// The top is fetched once more to start the crawl from
+		if id == "top" {
+			retries = 1
+		}
+
+		if len(fetched) != retries+1 {
+			t.Errorf("Expected reports of %s fetched %d times, got %d", id, retries+1, len(fetched))
+		}
+
+		if strings.Count(id, ".") == 4 {
+			t.Errorf("Expected reports of %s not to be fetched, they don't have any", id)
+		}
+	}
+
+	backoff := ultiproBackoff
+
+	for i := 1; i < len(fake.fetched["top.1.2"]); i++ {
+		if waited := fake.fetched["top.1.2"][i].Sub(fake.fetched["top.1.2"][i-1]); waited < backoff {
+			t.Errorf("Expected retry %d to wait at least %s, waited %s", i, backoff, waited)
+		}
+
+		backoff *= 2
+	}
+
+	if fake.maxInFlight < 2 {
+		t.Errorf("Expected requests to overlap with 4 workers, at most %d did", fake.maxInFlight)
+	}
+}
+
+func TestGetAllReportsHardError(t *testing.T) {
+	org := fakeOrg("top", 3, 2)
+	fake := &ultiproFake{
+		expireAfter: -1,
+		org:         &org,
+		failures:    map[string][]int{"top.1": {http.StatusNotFound}},
+		hang:        "top.0",
+	}
+
+	defer fake.start()()
+	defer setenv("ULTIPRO_PASSWORD", "hunter2")()
+
+	done := make(chan error)
+
+	go func() {
+		_, err := crawlFakeOrg(fake, 2)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "top.1") || !strings.Contains(err.Error(), "404") {
+			t.Errorf("Expected the 404 getting reports of top.1, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the hard error to cancel the worker still waiting on top.0")
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if len(fake.fetched["top.1"]) != 1 {
+		t.Errorf("Expected a 404 not to be retried, fetched %d times", len(fake.fetched["top.1"]))
+	}
+}
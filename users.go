@@ -1,9 +1,11 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -77,10 +79,15 @@ type User struct {
 	Avatar      string      `db:"avatar"`
 	Status      string      `db:"status"`
 	Title       string      `db:"title"`
+	Email       string      `db:"email"`
 	CreatedAt   time.Time   `db:"created_at"`
 	DeletedAt   pq.NullTime `db:"deleted_at"`
-	Admin       bool        `db:"admin"`
-	Bot         bool        `db:"bot"`
+	// Where CreatedAt came from and how much to trust it, see backfill.go
+	CreatedAtSource     string       `db:"created_at_source"`
+	CreatedAtConfidence float64      `db:"created_at_confidence"`
+	Admin               sql.NullBool `db:"admin"`
+	Bot                 bool         `db:"bot"`
+	Guest               bool         `db:"guest"`
 }
 
 func (user *User) IsMononym() bool {
@@ -113,6 +120,8 @@ func (user *User) LastName() string {
 }
 
 func (user *User) Update() error {
+	lookups.users = nil
+
 	_, err := db.NamedExec(`
     UPDATE users SET
 			name = :name,
@@ -122,7 +131,11 @@ func (user *User) Update() error {
 			deleted = :deleted,
 			deleted_at = :deleted_at,
 			status = :status,
-			title = :title
+			title = :title,
+			email = :email,
+			admin = :admin,
+			guest = :guest,
+			bot = :bot
 		WHERE
 		  id = :id
 	`, user)
@@ -131,12 +144,23 @@ func (user *User) Update() error {
 }
 
 func (user *User) Bury() error {
-	text := fmt.Sprintf("After %s, %s died of %s", user.Age(), user.SomeName(), randomDisease())
+	fate := user.Fate()
+	text := fmt.Sprintf("After %s, %s %s", user.Age(), user.Describe(), fate)
+	imageURL := user.Avatar
 
-	err := sendMessage(text, ":rip:", slack.Attachment{
-		ImageURL: user.Avatar,
-		Title:    "",
-	})
+	if tombstones {
+		url, err := uploadTombstone(user, fate)
+
+		if err != nil {
+			log.Printf("Couldn't draw tombstone for %s: %s\n", user.SomeName(), err)
+		} else {
+			imageURL = url
+		}
+	}
+
+	attachments := append([]slack.Attachment{{ImageURL: imageURL}}, themedAttachments(ImageDeath)...)
+
+	err := announce(userEvent(EventDeath, user, ":rip:", text), attachments...)
 
 	if err != nil {
 		return errors.Wrap(err, "sending rip message")
@@ -151,9 +175,9 @@ func (user *User) Bury() error {
 }
 
 func (user *User) ChangeName(newName string) error {
-	text := fmt.Sprintf("%s changed their handle from %s to %s", user.SomeName(), user.DisplayName, newName)
+	text := fmt.Sprintf("%s changed their handle from %s to %s", user.Describe(), user.DisplayName, newName)
 
-	err := sendMessage(text, ":name_badge:")
+	err := announce(userEvent(EventRename, user, ":name_badge:", text).Changed(user.DisplayName, newName))
 
 	if err != nil {
 		return errors.Wrap(err, "sending name change message")
@@ -179,12 +203,12 @@ func ignorableStatus(from, to string) bool {
 }
 
 func (user *User) ChangeStatus(newStatus string) error {
-	text := fmt.Sprintf("%s changed their status from %s to %s", user.SomeName(), user.Status, newStatus)
+	text := fmt.Sprintf("%s changed their status from %s to %s", user.Describe(), user.Status, newStatus)
 
 	if ignorableStatus(user.Status, newStatus) {
 		log.Println("Status is spam, not sending slack message...")
 	} else {
-		err := sendMessage(text, ":thought_balloon:")
+		err := announce(userEvent(EventStatus, user, ":thought_balloon:", text).Changed(user.Status, newStatus))
 
 		if err != nil {
 			return errors.Wrap(err, "sending status change message")
@@ -199,9 +223,9 @@ func (user *User) ChangeStatus(newStatus string) error {
 }
 
 func (user *User) ChangeTitle(newTitle string) error {
-	text := fmt.Sprintf("%s changed their title from %s to %s", user.SomeName(), user.Title, newTitle)
+	text := fmt.Sprintf("%s changed their title from %s to %s", user.Describe(), user.Title, newTitle)
 
-	err := sendMessage(text, ":name_badge:")
+	err := announce(userEvent(EventUserTitle, user, ":name_badge:", text).Changed(user.Title, newTitle))
 
 	if err != nil {
 		return errors.Wrap(err, "sending title change message")
@@ -214,10 +238,29 @@ func (user *User) ChangeTitle(newTitle string) error {
 	return errors.Wrapf(err, "updating user %s", user.Title)
 }
 
+func (user *User) ChangeAdmin(admin bool) error {
+	text := fmt.Sprintf("%s was made a trail boss", user.Describe())
+	if !admin {
+		text = fmt.Sprintf("%s is no longer a trail boss", user.Describe())
+	}
+
+	err := announce(userEvent(EventAdmin, user, ":key:", text).Changed(strconv.FormatBool(!admin), strconv.FormatBool(admin)))
+
+	if err != nil {
+		return errors.Wrap(err, "sending admin change message")
+	}
+
+	user.Admin = sql.NullBool{Bool: admin, Valid: true}
+
+	err = user.Update()
+
+	return errors.Wrapf(err, "updating user %s", user.DisplayName)
+}
+
 func (user *User) Necromance() error {
-	text := fmt.Sprintf("%s is back from the dead!", user.SomeName())
+	text := fmt.Sprintf("%s is back from the dead!", user.Describe())
 
-	err := sendMessage(text, ":zombie:", slack.Attachment{
+	err := announce(userEvent(EventNecromance, user, ":zombie:", text), slack.Attachment{
 		ImageURL: user.Avatar,
 		Title:    "",
 	})
@@ -226,6 +269,8 @@ func (user *User) Necromance() error {
 		return errors.Wrap(err, "sending zombie message")
 	}
 
+	lookups.users = nil
+
 	_, err = db.NamedExec(`
 		UPDATE users SET
 		  deleted = false,
@@ -243,6 +288,34 @@ func (user *User) SomeName() string {
 	}
 }
 
+// Describe is SomeName with org chart context when we know which employee the user is, e.g.
+// "Jane Doe (reports to Bob Smith)"
+func (user *User) Describe() string {
+	employee, err := employeeForUser(user)
+
+	if err != nil {
+		log.Printf("Couldn't find employee for %s: %s\n", user.SomeName(), err)
+		return user.SomeName()
+	}
+
+	if employee == nil || employee.SupervisorID == "" {
+		return user.SomeName()
+	}
+
+	supervisor, err := lookups.Employee(employee.SupervisorID)
+
+	if err != nil {
+		log.Printf("Couldn't find supervisor for %s: %s\n", user.SomeName(), err)
+		return user.SomeName()
+	}
+
+	if supervisor == nil {
+		return user.SomeName()
+	}
+
+	return fmt.Sprintf("%s (reports to %s)", user.SomeName(), supervisor.Name)
+}
+
 func (user *User) Age() time.Duration {
 	t := time.Now()
 
@@ -255,6 +328,15 @@ func (user *User) Age() time.Duration {
 	return duration
 }
 
+// findUser looks a user up by slack id, or by name with or without a leading @
+func findUser(ref string) (*User, error) {
+	user := User{}
+
+	err := db.Get(&user, "SELECT * from users where id = $1 or name = $2", ref, strings.TrimPrefix(ref, "@"))
+
+	return &user, errors.Wrapf(err, "find user %s failed", ref)
+}
+
 func getUser(name string) (*User, error) {
 	user := User{}
 
@@ -265,6 +347,7 @@ func getUser(name string) (*User, error) {
 
 func createUser(user *User) (*User, error) {
 	user.CreatedAt = time.Now()
+	lookups.users = nil
 
 	if user.Deleted {
 		user.DeletedAt = pq.NullTime{Time: time.Now(), Valid: true}
@@ -272,9 +355,9 @@ func createUser(user *User) (*User, error) {
 
 	_, err := db.NamedExec(`
 		INSERT INTO users
-		(id, name, real_name, display_name, avatar, deleted, deleted_at, created_at, status, title)
+		(id, name, real_name, display_name, avatar, deleted, deleted_at, created_at, status, title, email, created_at_source, created_at_confidence, admin, guest, bot)
 		VALUES
-		(:id, :name, :real_name, :display_name, :avatar, :deleted, :deleted_at, :created_at, :status, :title)
+		(:id, :name, :real_name, :display_name, :avatar, :deleted, :deleted_at, :created_at, :status, :title, :email, :created_at_source, :created_at_confidence, :admin, :guest, :bot)
 		`, user)
 
 	return user, errors.Wrapf(err, "inserting user %#v", user)
@@ -290,12 +373,18 @@ func fromSlacker(slacker slack.User) User {
 		Avatar:      slacker.Profile.ImageOriginal,
 		Status:      fmt.Sprintf("%s %s", slacker.Profile.StatusEmoji, slacker.Profile.StatusText),
 		Title:       slacker.Profile.Title,
-		Admin:       slacker.IsAdmin,
+		Email:       slacker.Profile.Email,
+		Admin:       sql.NullBool{Bool: slacker.IsAdmin, Valid: true},
 		Bot:         slacker.IsBot,
+		Guest:       slacker.IsRestricted || slacker.IsUltraRestricted,
 	}
 }
 
 func registerAndAnnounceBaby(baby User) error {
+	// We saw them show up, so this is as good as a join date gets
+	baby.CreatedAtSource = JoinDateObserved
+	baby.CreatedAtConfidence = 1
+
 	user, err := createUser(&baby)
 
 	if err != nil {
@@ -309,7 +398,7 @@ func registerAndAnnounceBaby(baby User) error {
 		text = "Congratulations, you have a beautiful new baby named %s"
 	}
 
-	err = sendMessage(fmt.Sprintf(text, user.SomeName()), ":baby:")
+	err = announce(userEvent(EventBirth, user, ":baby:", fmt.Sprintf(text, user.Describe())), themedAttachments(ImageBirth)...)
 
 	return errors.Wrap(err, "sending message")
 }
@@ -332,6 +421,10 @@ func initializeUsers() error {
 	}
 
 	for _, slackUser := range slackUsers {
+		// NOTE: Everyone already in slack gets today as their join date, trail backfill join-dates can
+		// do better
+		slackUser.CreatedAtSource = JoinDateInit
+
 		_, err := createUser(&slackUser)
 
 		if err != nil {
@@ -410,6 +503,31 @@ func diffUsers(knownUsers, slackUsers []User) error {
 				}
 			}
 
+			// We didn't always keep track of admins, so the first time we see whether someone is one
+			// isn't a change
+			if slackUser.Admin != user.Admin && user.Admin.Valid {
+				err := user.ChangeAdmin(slackUser.Admin.Bool)
+
+				if err != nil {
+					return errors.Wrap(err, "changing a users admin")
+				}
+			}
+
+			// Email, guest and bot aren't announced, just kept up to date for linking users to
+			// employees, routing and anniversaries
+			if slackUser.Email != user.Email || slackUser.Guest != user.Guest || slackUser.Bot != user.Bot || !user.Admin.Valid {
+				user.Email = slackUser.Email
+				user.Guest = slackUser.Guest
+				user.Bot = slackUser.Bot
+				user.Admin = slackUser.Admin
+
+				err := user.Update()
+
+				if err != nil {
+					return errors.Wrap(err, "updating a users email and roles")
+				}
+			}
+
 			// NOTE: This is too spammy
 			// if slackUser.Status != user.Status {
 			// 	err := user.ChangeStatus(slackUser.Status)
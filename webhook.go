@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// webhookVersion changes whenever the payload changes in a way receivers would notice
+const webhookVersion = 1
+
+// Tuning for posting to webhooks, see the webhook flags
+var (
+	webhookTimeout = 10 * time.Second
+	webhookRetries = 3
+)
+
+// webhookURLs get every event once, whatever its routes and digests, see WEBHOOK_URLS
+var webhookURLs = []string{}
+
+// WebhookPayload is what webhooks are posted. Events have their id, which stays the same when a
+// failed post is retried. Messages that aren't about an event, like trail reports, have the kind
+// "message" and no id or subject.
+type WebhookPayload struct {
+	Version    int             `json:"version"`
+	ID         int             `json:"id,omitempty"`
+	Kind       string          `json:"kind"`
+	Subject    *WebhookSubject `json:"subject,omitempty"`
+	Old        string          `json:"old,omitempty"`
+	New        string          `json:"new,omitempty"`
+	Text       string          `json:"text"`
+	Emoji      string          `json:"emoji,omitempty"`
+	Channel    string          `json:"channel,omitempty"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// WebhookSubject is who an event is about, a slack user or an employee
+type WebhookSubject struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+func webhookPayload(message Message, now time.Time) WebhookPayload {
+	payload := WebhookPayload{
+		Version:    webhookVersion,
+		Kind:       "message",
+		Text:       message.Text,
+		Emoji:      message.Emoji,
+		Channel:    message.Channel,
+		OccurredAt: now,
+	}
+
+	event := message.Event
+
+	if event == nil {
+		return payload
+	}
+
+	payload.ID = event.ID
+	payload.Kind = event.Kind
+	payload.Old = event.Old
+	payload.New = event.New
+
+	if !event.CreatedAt.IsZero() {
+		payload.OccurredAt = event.CreatedAt
+	}
+
+	switch {
+	case event.User != nil:
+		payload.Subject = &WebhookSubject{Type: "user", ID: event.User.ID, Name: event.User.SomeName()}
+	case event.UserID.Valid:
+		payload.Subject = &WebhookSubject{Type: "user", ID: event.UserID.String}
+	case event.Employee != nil:
+		payload.Subject = &WebhookSubject{Type: "employee", ID: event.Employee.ID, Name: event.Employee.Name}
+	case event.EmployeeID.Valid:
+		payload.Subject = &WebhookSubject{Type: "employee", ID: event.EmployeeID.String}
+	}
+
+	return payload
+}
+
+// webhookSignature lets receivers check a payload came from us, and the timestamp stops an old one
+// being replayed. It's hex encoded HMAC-SHA256 of the timestamp, a dot, and the body.
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookClient posts json to webhooks, retrying timeouts and server errors
+type webhookClient struct {
+	Client  *http.Client
+	Retries int
+	// Backoff is the wait before the first retry, it doubles after that
+	Backoff time.Duration
+}
+
+func newWebhookClient() webhookClient {
+	return webhookClient{
+		Client:  &http.Client{Timeout: webhookTimeout},
+		Retries: webhookRetries,
+		Backoff: 500 * time.Millisecond,
+	}
+}
+
+// PostJSON is for webhooks that don't need signing, like chat tools'
+func (client webhookClient) PostJSON(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return errors.Wrap(err, "encoding webhook payload")
+	}
+
+	return client.Post(url, body, nil)
+}
+
+// Post sends body to url, sign can add headers and is called again for every attempt
+func (client webhookClient) Post(url string, body []byte, sign func(*http.Request, []byte)) error {
+	var err error
+
+	for attempt := 0; attempt <= client.Retries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * client.Backoff
+
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Retrying webhook %s in %s after: %s\n", url, backoff, err)
+			}
+
+			time.Sleep(backoff)
+		}
+
+		err = client.post(url, body, sign)
+
+		if _, transient := err.(transientError); !transient {
+			return err
+		}
+	}
+
+	return errors.Wrapf(err, "giving up on webhook %s after %d retries", url, client.Retries)
+}
+
+func (client webhookClient) post(url string, body []byte, sign func(*http.Request, []byte)) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+
+	if err != nil {
+		return errors.Wrapf(err, "creating webhook request for %s", url)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "trail")
+
+	if sign != nil {
+		sign(req, body)
+	}
+
+	resp, err := client.Client.Do(req)
+
+	// Timeouts and connection failures are worth another try
+	if err != nil {
+		return transientError{errors.Wrapf(err, "posting to webhook %s", url)}
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return transientError{fmt.Errorf("posting to webhook %s, got %s", url, resp.Status)}
+	}
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("posting to webhook %s, got %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// webhookChannel is where an event is delivered to post it to a webhook
+func webhookChannel(url string) string {
+	return "webhook:" + url
+}
+
+func splitURLs(urls string) []string {
+	split := []string{}
+
+	for _, url := range strings.Split(urls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			split = append(split, url)
+		}
+	}
+
+	return split
+}
+
+// webhookMessenger posts messages as json to every url
+type webhookMessenger struct {
+	webhookClient
+	URLs   []string
+	Secret string
+}
+
+// newWebhookMessenger is the --messenger webhook, for messages that aren't about an event, like
+// trail reports. Events are posted to WEBHOOK_URLS once each by announce, whatever the messenger.
+func newWebhookMessenger(urls, secret string) (messageFunc, error) {
+	webhook := webhookMessenger{
+		webhookClient: newWebhookClient(),
+		URLs:          splitURLs(urls),
+		Secret:        secret,
+	}
+
+	if len(webhook.URLs) == 0 {
+		return nil, errors.New("the webhook messenger needs WEBHOOK_URLS")
+	}
+
+	return func(message Message) error {
+		if message.Event != nil {
+			return nil
+		}
+
+		return webhook.Send(message)
+	}, nil
+}
+
+// newWebhookMessengerTo posts to a webhook channel, like webhook:https://example.com/trail
+func newWebhookMessengerTo(url string) messageFunc {
+	return webhookMessenger{
+		webhookClient: newWebhookClient(),
+		URLs:          []string{url},
+		Secret:        os.Getenv("WEBHOOK_SECRET"),
+	}.Send
+}
+
+func (webhook webhookMessenger) Send(message Message) error {
+	body, err := json.Marshal(webhookPayload(message, time.Now()))
+
+	if err != nil {
+		return errors.Wrap(err, "encoding webhook payload")
+	}
+
+	sign := func(req *http.Request, body []byte) {
+		webhook.sign(req, body)
+
+		// NOTE: Receivers can drop an event they've already seen, in case we retry after a post
+		// they got but we didn't hear back about
+		if message.Event != nil && message.Event.ID != 0 {
+			req.Header.Set("Idempotency-Key", fmt.Sprintf("trail-event-%d", message.Event.ID))
+		}
+	}
+
+	for _, url := range webhook.URLs {
+		err := webhook.Post(url, body, sign)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (webhook webhookMessenger) sign(req *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("X-Trail-Timestamp", timestamp)
+
+	if webhook.Secret != "" {
+		req.Header.Set("X-Trail-Signature", webhookSignature(webhook.Secret, timestamp, body))
+	}
+}
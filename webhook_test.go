@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReceiver is a webhook, for us or a chat tool, that records every json request it gets and
+// answers with each of its statuses in turn, then 200s
+type fakeReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func newFakeReceiver(t *testing.T, statuses ...int) *fakeReceiver {
+	receiver := &fakeReceiver{}
+
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// NOTE: Handlers run on the server's goroutines, where the test can't be stopped with t.Fatal
+		body, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			t.Errorf("Error reading request %v", err)
+		}
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected json, got %s", r.Header.Get("Content-Type"))
+		}
+
+		receiver.mu.Lock()
+		receiver.requests = append(receiver.requests, r)
+		receiver.bodies = append(receiver.bodies, string(body))
+		attempt := len(receiver.requests)
+		receiver.mu.Unlock()
+
+		if attempt <= len(statuses) {
+			w.WriteHeader(statuses[attempt-1])
+		}
+	}))
+
+	return receiver
+}
+
+func (receiver *fakeReceiver) Requests() []*http.Request {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return append([]*http.Request{}, receiver.requests...)
+}
+
+func (receiver *fakeReceiver) Bodies() []string {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return append([]string{}, receiver.bodies...)
+}
+
+// checkSignatures checks every request was signed with the secret
+func (receiver *fakeReceiver) checkSignatures(t *testing.T, secret string) {
+	bodies := receiver.Bodies()
+
+	for i, r := range receiver.Requests() {
+		signature := webhookSignature(secret, r.Header.Get("X-Trail-Timestamp"), []byte(bodies[i]))
+
+		if r.Header.Get("X-Trail-Signature") != signature {
+			t.Errorf("expected signature %s, got %s", signature, r.Header.Get("X-Trail-Signature"))
+		}
+
+		if err := json.Unmarshal([]byte(bodies[i]), &WebhookPayload{}); err != nil {
+			t.Errorf("expected a webhook payload, got %s", bodies[i])
+		}
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	user := &User{ID: "U1", RealName: "Zach Taylor", DisplayName: "zach"}
+	event := userEvent(EventRename, user, ":name_badge:", "zach is now zt").Changed("zach", "zt")
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	payload := webhookPayload(Message{Text: event.Text, Emoji: event.Emoji, Channel: "C1", Event: event}, now)
+
+	if payload.Version != webhookVersion || payload.Kind != EventRename || payload.Old != "zach" || payload.New != "zt" {
+		t.Errorf("unexpected payload %#v", payload)
+	}
+
+	if payload.Subject == nil || *payload.Subject != (WebhookSubject{Type: "user", ID: "U1", Name: "Zach Taylor"}) {
+		t.Errorf("unexpected subject %#v", payload.Subject)
+	}
+
+	if payload.ID != 0 {
+		t.Errorf("expected an unsaved event to have no id, got %d", payload.ID)
+	}
+
+	event.ID = 42
+
+	if saved := webhookPayload(Message{Text: event.Text, Event: event}, now); saved.ID != 42 {
+		t.Errorf("expected the event id, got %d", saved.ID)
+	}
+
+	if !payload.OccurredAt.Equal(now) {
+		t.Errorf("expected an unsaved event to occur now, got %s", payload.OccurredAt)
+	}
+
+	report := webhookPayload(Message{Text: "Trail Report"}, now)
+
+	if report.Kind != "message" || report.Subject != nil {
+		t.Errorf("expected a plain message, got %#v", report)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	server := newFakeReceiver(t, 503, 429, 200)
+	defer server.Close()
+
+	webhook := webhookMessenger{URLs: []string{server.URL}, Secret: "secret", webhookClient: webhookClient{Client: server.Client(), Retries: 3}}
+
+	err := webhook.Send(Message{Text: "Testing, testing, 123...", Emoji: ":rip:"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts := len(server.Requests()); attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	server.checkSignatures(t, "secret")
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	server := newFakeReceiver(t, 500, 500, 500)
+	defer server.Close()
+
+	webhook := webhookMessenger{URLs: []string{server.URL}, Secret: "secret", webhookClient: webhookClient{Client: server.Client(), Retries: 2}}
+
+	if err := webhook.Send(Message{Text: "hello"}); err == nil {
+		t.Error("expected an error after running out of retries")
+	}
+
+	if attempts := len(server.Requests()); attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	rejecting := newFakeReceiver(t, 400)
+	defer rejecting.Close()
+
+	webhook.URLs = []string{rejecting.URL}
+
+	if err := webhook.Send(Message{Text: "hello"}); err == nil {
+		t.Error("expected an error for a rejected payload")
+	}
+
+	if attempts := len(rejecting.Requests()); attempts != 1 {
+		t.Errorf("expected a rejected payload not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestWebhookIdempotencyKey(t *testing.T) {
+	server := newFakeReceiver(t)
+	defer server.Close()
+
+	send := newWebhookMessengerTo(server.URL)
+
+	message := deathMessage()
+	message.Event.ID = 42
+
+	if err := send(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := send(Message{Text: "Trail Report"}); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := server.Requests()
+
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 posts, got %d", len(requests))
+	}
+
+	if key := requests[0].Header.Get("Idempotency-Key"); key != "trail-event-42" {
+		t.Errorf("expected the event's idempotency key, got %q", key)
+	}
+
+	if key := requests[1].Header.Get("Idempotency-Key"); key != "" {
+		t.Errorf("expected no idempotency key for a plain message, got %q", key)
+	}
+}
+
+func TestWebhookMessengerSkipsEvents(t *testing.T) {
+	server := newFakeReceiver(t)
+	defer server.Close()
+
+	send, err := newWebhookMessenger(server.URL+"/a, "+server.URL+"/b", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events are posted once each by announce, not for every channel they're routed to
+	if err := send(deathMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := send(Message{Text: "Trail Report"}); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{}
+
+	for _, r := range server.Requests() {
+		paths = append(paths, r.URL.Path)
+	}
+
+	if len(paths) != 2 || paths[0] != "/a" || paths[1] != "/b" {
+		t.Errorf("expected only the report to be posted to both urls, got %v", paths)
+	}
+}